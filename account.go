@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+var noQuotaEstimate *bool // 上传前不按最坏情况估算需要的空间
+
+// 115 账号的信息
+type accountInfo struct {
+	UserID      string     `json:"userID"`              // 用户 id
+	UserName    string     `json:"userName"`            // 用户名
+	VIP         bool       `json:"vip"`                 // 是否是 vip 会员
+	VIPExpire   *time.Time `json:"vipExpire,omitempty"` // vip 会员的到期时间，没有时为 nil
+	SpaceTotal  int64      `json:"spaceTotal"`          // 总空间
+	SpaceUsed   int64      `json:"spaceUsed"`           // 已用空间
+	SpaceRemain int64      `json:"spaceRemain"`         // 剩余空间
+	SizeLimit   int64      `json:"sizeLimit"`           // 上传文件的最大大小
+	PutLimit    int64      `json:"putLimit"`            // 普通模式上传文件的最大大小
+}
+
+// 以数字或字符串表示的大小，可能是浮点数
+func jsonSize(v *fastjson.Value, keys ...string) int64 {
+	v = v.Get(keys...)
+	if v == nil {
+		return 0
+	}
+	switch v.Type() {
+	case fastjson.TypeNumber:
+		f, _ := v.Float64()
+		return int64(f)
+	case fastjson.TypeString:
+		f, _ := strconv.ParseFloat(string(v.GetStringBytes()), 64)
+		return int64(f)
+	default:
+		return 0
+	}
+}
+
+// 以数字、字符串或布尔值表示的真假
+func jsonBool(v *fastjson.Value, keys ...string) bool {
+	v = v.Get(keys...)
+	if v == nil {
+		return false
+	}
+	switch v.Type() {
+	case fastjson.TypeTrue:
+		return true
+	case fastjson.TypeNumber:
+		n, _ := v.Int64()
+		return n > 0
+	case fastjson.TypeString:
+		n, _ := strconv.ParseInt(string(v.GetStringBytes()), 10, 64)
+		return n > 0
+	default:
+		return false
+	}
+}
+
+// 普通模式上传文件的最大大小，不超过账号允许上传的文件的最大大小
+func putSizeLimit() int64 {
+	return min(int64(maxPutSize), uploadSizeLimit())
+}
+
+// 获取 115 账号的用户名、vip 状态和空间使用情况
+func getAccountInfo() (*accountInfo, error) {
+	info := &accountInfo{
+		UserID:    userID,
+		SizeLimit: uploadSizeLimit(),
+		PutLimit:  putSizeLimit(),
+	}
+
+	v, err := getURLJSON(userInfoURL)
+	if err != nil {
+		return nil, err
+	}
+	if !v.GetBool("state") {
+		return nil, fmt.Errorf("获取账号信息失败：%s", v.GetStringBytes("error"))
+	}
+	info.UserName = string(v.GetStringBytes("data", "user_name"))
+	info.VIP = jsonBool(v, "data", "vip")
+	if expire := jsonSize(v, "data", "expire"); expire > 0 {
+		t := time.Unix(expire, 0)
+		info.VIPExpire = &t
+	}
+
+	v, err = getURLJSON(spaceInfoURL)
+	if err != nil {
+		return nil, err
+	}
+	if !v.GetBool("state") {
+		return nil, fmt.Errorf("获取空间使用情况失败：%s", v.GetStringBytes("error"))
+	}
+	info.SpaceTotal = jsonSize(v, "data", "space_info", "all_total", "size")
+	info.SpaceUsed = jsonSize(v, "data", "space_info", "all_use", "size")
+	info.SpaceRemain = jsonSize(v, "data", "space_info", "all_remain", "size")
+	if info.SpaceRemain == 0 && info.SpaceTotal > info.SpaceUsed {
+		info.SpaceRemain = info.SpaceTotal - info.SpaceUsed
+	}
+
+	return info, nil
+}
+
+// 最坏情况下（所有文件都不能秒传）需要上传数据的文件的总大小，秒传模式上传的文件不计算在内，
+// 断点续传的文件在上传完成后才占用 115 的空间，所以也按整个文件计算
+func worstUploadSize(files []fileInfo) int64 {
+	var total int64
+	for i := range files {
+		if files[i].mode() == modeFast {
+			continue
+		}
+		if info, err := os.Stat(files[i].Path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// 上传前按最坏情况估算剩余空间是否足够，实际上能秒传的文件越多需要的空间越少
+func checkQuota(files []fileInfo) error {
+	size := worstUploadSize(files)
+	if size == 0 {
+		return nil
+	}
+	info, err := getAccountInfo()
+	if err != nil {
+		return fmt.Errorf("获取账号信息出现错误，可以用参数 -no-quota-estimate 跳过估算：%w", err)
+	}
+	if *verbose {
+		log.Printf("最坏情况下需要上传 %s ，剩余空间 %s", formatSize(size), formatSize(info.SpaceRemain))
+	}
+	if info.SpaceTotal > 0 && size > info.SpaceRemain {
+		return fmt.Errorf("最坏情况下（所有文件都不能秒传）需要上传 %s ，超过了 115 的剩余空间 %s ，可以用参数 -no-quota-estimate 跳过估算",
+			formatSize(size), formatSize(info.SpaceRemain))
+	}
+	return nil
+}
+
+// whoami 子命令，显示 115 账号的信息
+func whoamiCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New("用法：whoami")
+	}
+	info, err := getAccountInfo()
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		return printJSON(info)
+	}
+	fmt.Printf("用户名：%s\n用户 id：%s\n", info.UserName, info.UserID)
+	switch {
+	case info.VIP && info.VIPExpire != nil:
+		fmt.Printf("vip 会员：是，到期时间 %s\n", info.VIPExpire.Format("2006-01-02"))
+	case info.VIP:
+		fmt.Println("vip 会员：是")
+	default:
+		fmt.Println("vip 会员：否")
+	}
+	fmt.Printf("空间：已用 %s ，剩余 %s ，共 %s\n", formatSize(info.SpaceUsed), formatSize(info.SpaceRemain), formatSize(info.SpaceTotal))
+	fmt.Printf("上传文件的最大大小：%s ，普通模式上传文件的最大大小：%s\n", formatSize(info.SizeLimit), formatSize(info.PutLimit))
+	return nil
+}
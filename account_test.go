@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+func TestJSONSizeAndBool(t *testing.T) {
+	v := fastjson.MustParse(`{"a":{"size":1.5e12},"b":"2048","c":1,"d":"0","e":true,"f":null}`)
+	if size := jsonSize(v, "a", "size"); size != 1500000000000 {
+		t.Errorf("jsonSize of float want: 1500000000000, result: %d", size)
+	}
+	if size := jsonSize(v, "b"); size != 2048 {
+		t.Errorf("jsonSize of string want: 2048, result: %d", size)
+	}
+	if size := jsonSize(v, "x"); size != 0 {
+		t.Errorf("jsonSize of missing key want: 0, result: %d", size)
+	}
+	for key, want := range map[string]bool{"c": true, "d": false, "e": true, "f": false, "x": false} {
+		if b := jsonBool(v, key); b != want {
+			t.Errorf("jsonBool of %s want: %v, result: %v", key, want, b)
+		}
+	}
+}
+
+func TestPutSizeLimit(t *testing.T) {
+	defer func(limit int64) { sizeLimit = limit }(sizeLimit)
+
+	sizeLimit = 0
+	if limit := putSizeLimit(); limit != maxPutSize {
+		t.Errorf("putSizeLimit without account limit want: %d, result: %d", int64(maxPutSize), limit)
+	}
+	sizeLimit = 1024 * 1024 * 1024
+	if limit := putSizeLimit(); limit != sizeLimit {
+		t.Errorf("putSizeLimit with account limit want: %d, result: %d", sizeLimit, limit)
+	}
+}
+
+func TestWorstUploadSize(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	files := []fileInfo{
+		{Path: write("fast", 100), Mode: modeFast},
+		{Path: write("normal", 200), Mode: modeNormal},
+		{Path: write("multipart", 300), Mode: modeMultipart},
+		{Path: write("auto", 400), Mode: "auto"},
+		{Path: filepath.Join(dir, "missing"), Mode: modeNormal},
+	}
+	if size := worstUploadSize(files); size != 900 {
+		t.Errorf("worst upload size want: 900, result: %d", size)
+	}
+}
+
+func TestAccountInfoVIPExpire(t *testing.T) {
+	data, err := json.Marshal(accountInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "vipExpire") {
+		t.Errorf("vipExpire should be omitted: %s", data)
+	}
+
+	expire := time.Unix(1700000000, 0).UTC()
+	data, err = json.Marshal(accountInfo{VIP: true, VIPExpire: &expire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"vipExpire":"2023-11-14T22:13:20Z"`) {
+		t.Errorf("vipExpire want 2023-11-14T22:13:20Z: %s", data)
+	}
+}
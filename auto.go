@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// 账号允许上传的文件的最大大小
+func uploadSizeLimit() int64 {
+	if sizeLimit > 0 && sizeLimit < maxFileSize {
+		return sizeLimit
+	}
+	return maxFileSize
+}
+
+// 检查文件大小是否超过账号允许上传的文件的最大大小
+func checkSizeLimit(file string, size int64) error {
+	limit := uploadSizeLimit()
+	if size <= limit {
+		return nil
+	}
+	if limit < maxFileSize {
+		return fmt.Errorf("%s 的大小超过%s，上传更大的文件需要 115 vip 会员，取消上传", file, formatSize(limit))
+	}
+	return fmt.Errorf("%s 的大小超过%s，取消上传", file, formatSize(limit))
+}
+
+// 普通模式下改用断点续传模式上传的文件大小，取普通模式上传文件的最大大小和设置的大小中较小的一个
+func multipartThreshold() int64 {
+	return min(putSizeLimit(), int64(config.MultipartSize)*1024*1024)
+}
+
+// 是否使用断点续传模式上传指定大小的文件
+func useMultipart(size int64) bool {
+	// 断点续传模式上传的文件大小不能小于 1KB
+	if size <= 1024 {
+		return false
+	}
+	return size > multipartThreshold()
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestUseMultipart(t *testing.T) {
+	defer func(limit int64, size uint64) {
+		sizeLimit, config.MultipartSize = limit, size
+	}(sizeLimit, config.MultipartSize)
+
+	const mb = 1024 * 1024
+	tests := []struct {
+		name          string
+		sizeLimit     int64
+		multipartSize uint64
+		size          int64
+		want          bool
+	}{
+		{"1KB", 0, 100, 1024, false},
+		{"1KB even above threshold", 0, 0, 1024, false},
+		{"just above 1KB", 0, 0, 1025, true},
+		{"at multipart size", 0, 100, 100 * mb, false},
+		{"above multipart size", 0, 100, 100*mb + 1, true},
+		{"at put limit", 0, 10 * 1024, maxPutSize, false},
+		{"above put limit", 0, 10 * 1024, maxPutSize + 1, true},
+		{"above account limit", 1024 * mb, 10 * 1024, 1024*mb + 1, true},
+		{"at account limit", 1024 * mb, 10 * 1024, 1024 * mb, false},
+	}
+	for _, tt := range tests {
+		sizeLimit, config.MultipartSize = tt.sizeLimit, tt.multipartSize
+		if result := useMultipart(tt.size); result != tt.want {
+			t.Errorf("%s: useMultipart(%d) want: %v, result: %v", tt.name, tt.size, tt.want, result)
+		}
+	}
+}
+
+func TestUploadSizeLimit(t *testing.T) {
+	defer func(limit int64) { sizeLimit = limit }(sizeLimit)
+
+	tests := []struct {
+		sizeLimit int64
+		want      int64
+	}{
+		{0, maxFileSize},
+		{-1, maxFileSize},
+		{5 * 1024 * 1024 * 1024, 5 * 1024 * 1024 * 1024},
+		{maxFileSize * 2, maxFileSize},
+	}
+	for _, tt := range tests {
+		sizeLimit = tt.sizeLimit
+		if result := uploadSizeLimit(); result != tt.want {
+			t.Errorf("uploadSizeLimit() with size_limit %d want: %d, result: %d", tt.sizeLimit, tt.want, result)
+		}
+		if err := checkSizeLimit("a", tt.want); err != nil {
+			t.Errorf("checkSizeLimit() at the limit should pass: %v", err)
+		}
+		if err := checkSizeLimit("a", tt.want+1); err == nil {
+			t.Errorf("checkSizeLimit() above the limit %d should fail", tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// hash 缓存里的文件信息
+type cacheEntry struct {
+	Path      string   `json:"path"`               // 文件的绝对路径
+	Size      int64    `json:"size"`               // 文件大小
+	ModTime   int64    `json:"modTime"`            // 文件的修改时间（纳秒）
+	SHA1      string   `json:"sha1"`               // 整个文件的 sha1 值
+	BlockHash string   `json:"blockHash"`          // 文件最前面一个区块的 sha1 值
+	CRC64     uint64   `json:"crc64,omitempty"`    // 整个文件的 crc64 值，为 0 时没有缓存
+	PartsMD5  []string `json:"partsMD5,omitempty"` // 每个分片的 md5 值（base64 编码）
+	PartSize  int64    `json:"partSize,omitempty"` // 计算 PartsMD5 时每个分片的大小
+	HashTime  int64    `json:"hashTime"`           // 计算 hash 值的时间（秒）
+}
+
+// 保存在本地文件里的 hash 缓存
+type hashCacheData struct {
+	mu      sync.Mutex
+	file    string                 // 缓存文件
+	changed bool                   // 缓存是否有改动
+	Entries map[string]*cacheEntry `json:"entries"` // 以设备号和 inode 为键，不支持 inode 的系统以文件路径为键
+}
+
+var hashCache *hashCacheData // hash 缓存，为 nil 时不使用缓存
+
+// 读取 hash 缓存文件，文件不存在时新建缓存
+func loadHashCache(file string) (hc *hashCacheData, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("loadHashCache() error: %v", err)
+		}
+	}()
+
+	hc = &hashCacheData{file: file, Entries: make(map[string]*cacheEntry)}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return hc, nil
+	}
+	checkErr(err)
+	err = json.Unmarshal(data, hc)
+	checkErr(err)
+	if hc.Entries == nil {
+		hc.Entries = make(map[string]*cacheEntry)
+	}
+
+	return hc, nil
+}
+
+// 文件在缓存里的键
+func cacheKey(path string, info fs.FileInfo) (key, abs string, e error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	if dev, ino, ok := fileID(info); ok {
+		return fmt.Sprintf("%d-%d", dev, ino), abs, nil
+	}
+	return abs, abs, nil
+}
+
+// 获取缓存里的 hash 值，文件大小或修改时间改变时视为没有缓存
+func (hc *hashCacheData) get(path string, info fs.FileInfo) (fh *fileHash, ok bool) {
+	if hc == nil {
+		return nil, false
+	}
+	key, _, err := cacheKey(path, info)
+	if err != nil {
+		return nil, false
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	entry, ok := hc.Entries[key]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	if *verbose {
+		log.Printf("使用 %s 缓存的 hash 值：%s", path, entry.SHA1)
+	}
+	return &fileHash{
+		BlockHash: entry.BlockHash,
+		TotalHash: entry.SHA1,
+		PartsMD5:  entry.PartsMD5,
+		PartSize:  entry.PartSize,
+		CRC64:     entry.CRC64,
+	}, true
+}
+
+// 将文件的 hash 值保存到缓存里
+func (hc *hashCacheData) put(path string, info fs.FileInfo, fh *fileHash) {
+	if hc == nil {
+		return
+	}
+	key, abs, err := cacheKey(path, info)
+	if err != nil {
+		return
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.Entries[key] = &cacheEntry{
+		Path:      abs,
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		SHA1:      fh.TotalHash,
+		BlockHash: fh.BlockHash,
+		CRC64:     fh.CRC64,
+		PartsMD5:  fh.PartsMD5,
+		PartSize:  fh.PartSize,
+		HashTime:  time.Now().Unix(),
+	}
+	hc.changed = true
+}
+
+// 删除已经不存在或者已经改变的文件的缓存，返回删除的数量
+func (hc *hashCacheData) prune() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	n := 0
+	for key, entry := range hc.Entries {
+		info, err := os.Stat(entry.Path)
+		if err == nil {
+			if k, _, err := cacheKey(entry.Path, info); err == nil && k == key &&
+				entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano() {
+				continue
+			}
+		}
+		if *verbose {
+			log.Printf("删除 %s 的缓存", entry.Path)
+		}
+		delete(hc.Entries, key)
+		n++
+	}
+	if n != 0 {
+		hc.changed = true
+	}
+	return n
+}
+
+// 保存 hash 缓存到文件
+func (hc *hashCacheData) save() {
+	if hc == nil {
+		return
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !hc.changed {
+		return
+	}
+	if err := writeJSONFile(hc.file, hc); err != nil {
+		log.Printf("保存 hash 缓存文件 %s 出现错误：%v", hc.file, err)
+		return
+	}
+	hc.changed = false
+}
+
+// 将数据以 json 格式写入文件，先写入临时文件，避免写入中断导致文件损坏
+func writeJSONFile(file string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// 优先使用缓存的 hash 值，没有缓存时计算文件的 hash 值并保存到缓存里，
+// verify 为 true 时缓存里没有 crc64 值或者 chunks 对应的分片的 md5 值的话只计算这些值，
+// read 不为 nil 时记录计算 hash 值时已经读取的数据大小
+func cachedHashFile(f *os.File, verify bool, chunks []oss.FileChunk, progress bool, read *atomic.Int64) (*fileHash, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fh, ok := hashCache.get(f.Name(), info)
+	switch {
+	case !ok:
+		if fh, err = sumFile(f, true, verify, chunks, progress, read); err != nil {
+			return nil, err
+		}
+	case verify && !fh.hasVerifyData(chunks):
+		// 只计算 -check-hash 需要的值，不重新计算 sha1 值
+		sums, err := sumFile(f, false, true, chunks, progress, read)
+		if err != nil {
+			return nil, err
+		}
+		fh.CRC64 = sums.CRC64
+		if len(chunks) != 0 {
+			fh.PartsMD5, fh.PartSize = sums.PartsMD5, sums.PartSize
+		}
+	default:
+		return uploadHash(fh, verify, chunks), nil
+	}
+	hashCache.put(f.Name(), info, fh)
+	return uploadHash(fh, verify, chunks), nil
+}
+
+// 上传时使用的 hash 值，只在 verify 为 true 时返回用于校验 chunks 的 crc64 值和分片的 md5 值
+func uploadHash(fh *fileHash, verify bool, chunks []oss.FileChunk) *fileHash {
+	uh := &fileHash{BlockHash: fh.BlockHash, TotalHash: fh.TotalHash}
+	if verify {
+		uh.CRC64 = fh.CRC64
+		if len(chunks) != 0 {
+			uh.PartsMD5 = fh.PartsMD5
+		}
+	}
+	return uh
+}
+
+// 计算文件的 hash 值并保存到缓存里
+func rehashFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fh, err := hashFile(f, false, nil, true)
+	if err != nil {
+		return err
+	}
+	hashCache.put(path, info, fh)
+	log.Printf("%s 的 sha1 值是 %s", path, fh.TotalHash)
+	return nil
+}
+
+// hashcache 子命令，查看、清理和重建 hash 缓存
+func hashCacheCommand(args []string) error {
+	if hashCache == nil {
+		return fmt.Errorf("没有设置 hash 缓存文件，请设置设置文件的 hashCache 或者使用参数 -hash-cache")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("请指定 list、prune 或 rebuild")
+	}
+	defer hashCache.save()
+
+	switch args[0] {
+	case "list":
+		entries := make([]*cacheEntry, 0, len(hashCache.Entries))
+		for _, entry := range hashCache.Entries {
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Path < entries[j].Path
+		})
+		for _, entry := range entries {
+			fmt.Printf("%s %s %s %s\n", entry.SHA1, formatSize(entry.Size),
+				time.Unix(0, entry.ModTime).Format("2006-01-02 15:04:05"), entry.Path)
+		}
+		fmt.Printf("共缓存了 %d 个文件的 hash 值\n", len(entries))
+	case "prune":
+		n := hashCache.prune()
+		log.Printf("删除了 %d 个文件的缓存", n)
+	case "rebuild":
+		paths := args[1:]
+		if len(paths) == 0 {
+			// 重新计算缓存里所有文件的 hash 值
+			hashCache.prune()
+			for _, entry := range hashCache.Entries {
+				paths = append(paths, entry.Path)
+			}
+		}
+		failed := 0
+		for _, path := range paths {
+			err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				if err := rehashFile(path); err != nil {
+					log.Printf("计算 %s 的 hash 值出现错误：%v", path, err)
+					failed++
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("重建 %s 的缓存出现错误：%v", path, err)
+				failed++
+			}
+		}
+		if failed != 0 {
+			return fmt.Errorf("有 %d 个文件计算 hash 值失败", failed)
+		}
+	default:
+		return fmt.Errorf("不支持 %s ，请指定 list、prune 或 rebuild", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+func TestHashCache(t *testing.T) {
+	verbose = new(bool)
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "cache.json")
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("fake115uploader"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc, err := loadHashCache(cacheFile)
+	if err != nil {
+		t.Fatalf("load hash cache error: %v", err)
+	}
+	fh := &fileHash{BlockHash: "BLOCK", TotalHash: "TOTAL"}
+	hc.put(file, info, fh)
+	hc.save()
+
+	hc, err = loadHashCache(cacheFile)
+	if err != nil {
+		t.Fatalf("load hash cache error: %v", err)
+	}
+	cached, ok := hc.get(file, info)
+	if !ok || cached.TotalHash != fh.TotalHash || cached.BlockHash != fh.BlockHash {
+		t.Errorf("cached hash want: %+v, result: %+v", fh, cached)
+	}
+
+	// 修改时间改变后缓存失效
+	mtime := info.ModTime().Add(time.Hour)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hc.get(file, info); ok {
+		t.Error("hash cache should be invalid after the file is modified")
+	}
+	if n := hc.prune(); n != 1 {
+		t.Errorf("pruned entries want: 1, result: %d", n)
+	}
+}
+
+func TestCachedHashFileVerify(t *testing.T) {
+	verbose = new(bool)
+	defer func(hc *hashCacheData) { hashCache = hc }(hashCache)
+	dir := t.TempDir()
+	hashCache = &hashCacheData{file: filepath.Join(dir, "cache.json"), Entries: make(map[string]*cacheEntry)}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("fake115uploader hash cache"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := []oss.FileChunk{{Number: 1, Offset: 0, Size: 13}, {Number: 2, Offset: 13, Size: info.Size() - 13}}
+	want, err := hashFile(f, true, chunks, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := func() *cacheEntry {
+		key, _, err := cacheKey(file, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashCache.Entries[key]
+	}
+
+	// 不校验时只缓存 sha1 值
+	fh, err := cachedHashFile(f, false, chunks, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fh.TotalHash != want.TotalHash || fh.CRC64 != 0 || fh.PartsMD5 != nil {
+		t.Errorf("hash without verify want only sha1, result: %+v", fh)
+	}
+
+	// 校验时使用缓存的 sha1 值，只计算缓存里没有的 crc64 值和分片的 md5 值
+	entry().SHA1 = "CACHED"
+	fh, err = cachedHashFile(f, true, chunks, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fh.TotalHash != "CACHED" || fh.CRC64 != want.CRC64 || !reflect.DeepEqual(fh.PartsMD5, want.PartsMD5) {
+		t.Errorf("hash with verify want cached sha1 and %+v, result: %+v", want, fh)
+	}
+
+	// 缓存里已经有校验需要的值时不再读取文件
+	entry().CRC64 = 123
+	fh, err = cachedHashFile(f, true, chunks, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fh.CRC64 != 123 || !reflect.DeepEqual(fh.PartsMD5, want.PartsMD5) {
+		t.Errorf("hash with cached checksums want crc64 123, result: %+v", fh)
+	}
+
+	// 分片大小改变时重新计算分片的 md5 值
+	whole := []oss.FileChunk{{Number: 1, Offset: 0, Size: info.Size()}}
+	fh, err = cachedHashFile(f, true, whole, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fh.TotalHash != "CACHED" || len(fh.PartsMD5) != 1 || fh.CRC64 != want.CRC64 {
+		t.Errorf("hash with new chunks want 1 part md5, result: %+v", fh)
+	}
+	if e := entry(); e.PartSize != info.Size() || len(e.PartsMD5) != 1 {
+		t.Errorf("cached parts want 1 part of size %d, result: %+v", info.Size(), e)
+	}
+}
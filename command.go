@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// 带有退出码的子命令错误
+type commandError struct {
+	code int
+	err  error
+}
+
+func (e *commandError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// 子命令
+type subcommand struct {
+	usage     string                    // 用法说明
+	run       func(args []string) error // 运行子命令，args 是除去参数后剩下的命令行参数
+	noCookies bool                      // 不需要 Cookie，运行前不获取 userkey
+}
+
+var (
+	cmdName    string // 要运行的子命令的名字，为空时上传文件
+	jsonOutput *bool  // 子命令以 json 格式输出结果
+	exitCode   int    // 程序的退出码
+	commands   = map[string]subcommand{
+		"cleanup": {
+			usage: "cleanup [存档文件...]：取消存档文件里记录的断点续传上传并删除存档文件，不指定存档文件时只清理 -d 指定的文件夹里原文件已经不存在或者上传已经失效的存档文件（加上 -cleanup-all 时清理所有存档文件）",
+			run:   cleanupCommand,
+		},
+		"login": {
+			usage:     "login：扫码登录 115 并将 Cookie 保存到设置文件，用 -login-app 指定模拟的客户端",
+			run:       loginCommand,
+			noCookies: true,
+		},
+		"whoami": {
+			usage: "whoami：显示 115 账号的用户名、vip 状态和空间使用情况",
+			run:   whoamiCommand,
+		},
+		"mv": {
+			usage: "mv 文件或文件夹... 目标文件夹：移动 115 里的文件或文件夹，文件和文件夹可以是路径或者 id:123 形式的 id",
+			run:   mvCommand,
+		},
+		"cp": {
+			usage: "cp 文件或文件夹... 目标文件夹：复制 115 里的文件或文件夹",
+			run:   cpCommand,
+		},
+		"rename": {
+			usage: "rename 文件或文件夹 新名字 [文件或文件夹 新名字...]：重命名 115 里的文件或文件夹",
+			run:   renameCommand,
+		},
+		"rm": {
+			usage: "rm 文件或文件夹...：删除 115 里的文件或文件夹",
+			run:   rmCommand,
+		},
+		"share": {
+			usage: "share 文件或文件夹...：分享 115 里的文件或文件夹，有效天数和访问码由 -share-days 和 -share-code 指定",
+			run:   shareCommand,
+		},
+		"dupes": {
+			usage: "dupes 115文件夹的路径或者 id:cid：按 sha1 查找 115 文件夹里的重复文件，可以用 -dupes-delete 或 -dupes-move 配合 -confirm 处理多余的重复文件",
+			run:   dupesCommand,
+		},
+		"verify": {
+			usage: "verify 本地文件夹 115文件夹的路径或者 id:cid：比较本地文件夹和 115 文件夹里的文件，有文件不一致时退出码为 2",
+			run:   verifyCommand,
+		},
+		"history": {
+			usage:     "history [序号]：列出上传状态文件里的运行记录，指定序号时显示该次运行的上传结果",
+			run:       historyCommand,
+			noCookies: true,
+		},
+		"hashcache": {
+			usage:     "hashcache list|prune|rebuild [文件或文件夹...]：查看 hash 缓存、删除失效的缓存或者重新计算指定文件（不指定时为缓存里的所有文件）的 hash 值",
+			run:       hashCacheCommand,
+			noCookies: true,
+		},
+	}
+)
+
+// 解析命令行参数，第一个参数是子命令时去掉该参数
+func parseArgs() {
+	args := os.Args[1:]
+	if len(args) != 0 {
+		if _, ok := commands[args[0]]; ok {
+			cmdName = args[0]
+			args = args[1:]
+		}
+	}
+
+	flag.Usage = printUsage
+	// flag.CommandLine 出错时会直接退出
+	_ = flag.CommandLine.Parse(args)
+}
+
+// 打印帮助信息
+func printUsage() {
+	fmt.Fprintln(flag.CommandLine.Output(), "用法：fake115uploader [子命令] [参数] [文件...]")
+	flag.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(flag.CommandLine.Output(), "子命令：")
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n", commands[name].usage)
+	}
+}
+
+// 运行子命令，出现错误时设置退出码
+func runCommand() error {
+	err := commands[cmdName].run(flag.Args())
+	if err != nil {
+		exitCode = 1
+		var ce *commandError
+		if errors.As(err, &ce) {
+			exitCode = ce.code
+		}
+	}
+	return err
+}
+
+// 以 json 格式输出到标准输出
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
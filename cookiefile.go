@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 115 必需的 Cookie
+var requiredCookies = []string{"UID", "CID", "SEID"}
+
+// 从浏览器导出的 Cookie
+type browserCookie struct {
+	Domain  string    // 域名
+	Name    string    // 名字
+	Value   string    // 值
+	Expires time.Time // 过期时间，为零值时是会话 Cookie
+}
+
+// 浏览器扩展导出的 json 格式的 Cookie，兼容 EditThisCookie、Cookie-Editor 等扩展
+type jsonCookie struct {
+	Domain         string          `json:"domain"`
+	Host           string          `json:"host"`
+	Name           string          `json:"name"`
+	Value          string          `json:"value"`
+	ExpirationDate json.RawMessage `json:"expirationDate"`
+	Expires        json.RawMessage `json:"expires"`
+	Expiry         json.RawMessage `json:"expiry"`
+}
+
+// 解析以数字（秒）或者日期字符串表示的过期时间
+func parseExpiry(raw json.RawMessage) time.Time {
+	if len(raw) == 0 || string(raw) == "null" {
+		return time.Time{}
+	}
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		if f <= 0 {
+			return time.Time{}
+		}
+		return time.Unix(int64(f), 0)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+			return time.Unix(int64(f), 0)
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// 解析 json 格式的 Cookie，支持 Cookie 数组或者包含 cookies 数组的对象
+func parseJSONCookies(data []byte) ([]browserCookie, error) {
+	var list []jsonCookie
+	if err := json.Unmarshal(data, &list); err != nil {
+		var obj struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if e := json.Unmarshal(data, &obj); e != nil || obj.Cookies == nil {
+			return nil, fmt.Errorf("解析 json 格式的 Cookie 出现错误：%w", err)
+		}
+		list = obj.Cookies
+	}
+
+	cookies := make([]browserCookie, 0, len(list))
+	for _, c := range list {
+		domain := c.Domain
+		if domain == "" {
+			domain = c.Host
+		}
+		expires := parseExpiry(c.ExpirationDate)
+		if expires.IsZero() {
+			expires = parseExpiry(c.Expires)
+		}
+		if expires.IsZero() {
+			expires = parseExpiry(c.Expiry)
+		}
+		cookies = append(cookies, browserCookie{Domain: domain, Name: c.Name, Value: c.Value, Expires: expires})
+	}
+	return cookies, nil
+}
+
+// 解析 Netscape 格式的 cookies.txt
+func parseNetscapeCookies(data []byte) ([]browserCookie, error) {
+	var cookies []browserCookie
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	row := 0
+	for scanner.Scan() {
+		row++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// curl 等工具导出的 HttpOnly Cookie 以 #HttpOnly_ 开头
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("cookies.txt 第 %d 行的格式不正确", row)
+		}
+		var expires time.Time
+		if n, err := strconv.ParseInt(fields[4], 10, 64); err == nil && n > 0 {
+			expires = time.Unix(n, 0)
+		}
+		cookies = append(cookies, browserCookie{Domain: fields[0], Name: fields[5], Value: fields[6], Expires: expires})
+	}
+	return cookies, scanner.Err()
+}
+
+// 解析 Cookie 文件，根据内容判断是 json 格式还是 Netscape 格式
+func parseCookieFile(data []byte) ([]browserCookie, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseJSONCookies(trimmed)
+	}
+	return parseNetscapeCookies(data)
+}
+
+// 是否是 115.com 的域名
+func is115Domain(domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+	return domain == "115.com" || strings.HasSuffix(domain, ".115.com")
+}
+
+// 用 115.com 的 Cookie 生成请求头，同名的 Cookie 优先使用没有过期且过期时间较晚的，
+// 返回缺少或者已经过期的必需的 Cookie 的提示
+func cookieHeader(cookies []browserCookie, now time.Time) (header string, warnings []string) {
+	expired := func(c browserCookie) bool {
+		return !c.Expires.IsZero() && c.Expires.Before(now)
+	}
+	later := func(a, b browserCookie) bool {
+		if expired(a) != expired(b) {
+			return !expired(a)
+		}
+		return a.Expires.IsZero() || (!b.Expires.IsZero() && a.Expires.After(b.Expires))
+	}
+
+	var names []string
+	byName := make(map[string]browserCookie)
+	for _, c := range cookies {
+		if !is115Domain(c.Domain) || c.Name == "" {
+			continue
+		}
+		old, ok := byName[c.Name]
+		if !ok {
+			names = append(names, c.Name)
+		}
+		if !ok || later(c, old) {
+			byName[c.Name] = c
+		}
+	}
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+byName[name].Value)
+	}
+	for _, name := range requiredCookies {
+		c, ok := byName[name]
+		switch {
+		case !ok:
+			warnings = append(warnings, fmt.Sprintf("缺少 Cookie %s", name))
+		case expired(c):
+			warnings = append(warnings, fmt.Sprintf("Cookie %s 已经在 %s 过期", name, c.Expires.Format("2006-01-02 15:04:05")))
+		}
+	}
+	return strings.Join(pairs, "; "), warnings
+}
+
+// 读取浏览器导出的 Cookie 文件，返回 115 的 Cookie 请求头
+func loadCookieFile(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	cookies, err := parseCookieFile(data)
+	if err != nil {
+		return "", err
+	}
+	header, warnings := cookieHeader(cookies, time.Now())
+	if header == "" {
+		return "", fmt.Errorf("Cookie 文件 %s 里没有 115.com 的 Cookie", file)
+	}
+	for _, w := range warnings {
+		log.Printf("Cookie 文件 %s 里%s，可能需要重新登录后再导出", file, w)
+	}
+	return header, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCookieFile(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	netscape := "# Netscape HTTP Cookie File\n" +
+		".115.com\tTRUE\t/\tFALSE\t1800000000\tUID\t1_A1\n" +
+		"#HttpOnly_.115.com\tTRUE\t/\tTRUE\t1800000000\tCID\tabc\n" +
+		".115.com\tTRUE\t/\tFALSE\t1600000000\tSEID\told\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tUID\tother\n"
+	cookies, err := parseCookieFile([]byte(netscape))
+	if err != nil {
+		t.Fatalf("parseCookieFile() netscape error: %v", err)
+	}
+	header, warnings := cookieHeader(cookies, now)
+	if want := "UID=1_A1; CID=abc; SEID=old"; header != want {
+		t.Errorf("netscape header want: %s, result: %s", want, header)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "SEID") {
+		t.Errorf("netscape warnings should report expired SEID: %v", warnings)
+	}
+
+	jsonData := `[{"domain":".115.com","name":"UID","value":"1_A1","expirationDate":1800000000.5},
+		{"domain":"webapi.115.com","name":"UID","value":"expired","expirationDate":1600000000},
+		{"domain":".115.com","name":"CID","value":"abc","session":true}]`
+	cookies, err = parseCookieFile([]byte(jsonData))
+	if err != nil {
+		t.Fatalf("parseCookieFile() json error: %v", err)
+	}
+	header, warnings = cookieHeader(cookies, now)
+	if want := "UID=1_A1; CID=abc"; header != want {
+		t.Errorf("json header want: %s, result: %s", want, header)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "SEID") {
+		t.Errorf("json warnings should report missing SEID: %v", warnings)
+	}
+
+	cookies, err = parseCookieFile([]byte(`{"cookies":[{"host":"115.com","name":"SEID","value":"x","expires":"2030-01-01T00:00:00Z"}]}`))
+	if err != nil || len(cookies) != 1 || cookies[0].Expires.Year() != 2030 {
+		t.Errorf("parseCookieFile() wrapped json result: %+v, error: %v", cookies, err)
+	}
+
+	if _, err := parseCookieFile([]byte("bad line")); err == nil {
+		t.Error("parseCookieFile() should fail on malformed netscape line")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 115 网盘里的文件夹不存在
+var errDirNotFound = errors.New("文件夹不存在")
+
+// 保存在本地文件里的 115 文件夹缓存
+type dirCacheData struct {
+	mu      sync.Mutex
+	file    string                         // 缓存文件
+	changed bool                           // 缓存是否有改动
+	checked map[uint64]bool                // 本次运行已经确认还存在的文件夹
+	exists  func(cid uint64) (bool, error) // 判断 115 网盘里是否存在文件夹
+	Dirs    map[string]uint64              `json:"dirs"` // 以上级文件夹的 cid 和文件夹名字为键，值为文件夹的 cid
+}
+
+var dirCache *dirCacheData // 文件夹缓存，为 nil 时不使用缓存
+
+// 读取文件夹缓存文件，文件不存在时新建缓存
+func loadDirCache(file string) (dc *dirCacheData, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("loadDirCache() error: %v", err)
+		}
+	}()
+
+	dc = newDirCache(file)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return dc, nil
+	}
+	checkErr(err)
+	err = json.Unmarshal(data, dc)
+	checkErr(err)
+	if dc.Dirs == nil {
+		dc.Dirs = make(map[string]uint64)
+	}
+
+	return dc, nil
+}
+
+func newDirCache(file string) *dirCacheData {
+	return &dirCacheData{
+		file:    file,
+		checked: make(map[uint64]bool),
+		exists:  dirExists,
+		Dirs:    make(map[string]uint64),
+	}
+}
+
+// 文件夹在缓存里的键
+func dirKey(pid uint64, name string) string {
+	return strconv.FormatUint(pid, 10) + "/" + name
+}
+
+// 获取缓存里的文件夹的 cid
+func (dc *dirCacheData) get(pid uint64, name string) (cid uint64, ok bool) {
+	if dc == nil {
+		return 0, false
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	cid, ok = dc.Dirs[dirKey(pid, name)]
+	return cid, ok
+}
+
+// 将文件夹的 cid 保存到缓存里
+func (dc *dirCacheData) put(pid uint64, name string, cid uint64) {
+	if dc == nil {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if c, ok := dc.Dirs[dirKey(pid, name)]; ok && c == cid {
+		return
+	}
+	dc.Dirs[dirKey(pid, name)] = cid
+	dc.changed = true
+}
+
+// 删除 cid 对应文件夹及其子文件夹的缓存
+func (dc *dirCacheData) invalidate(cid uint64) {
+	if dc == nil {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	removed := map[uint64]bool{cid: true}
+	for changed := true; changed; {
+		changed = false
+		for key, c := range dc.Dirs {
+			pid, err := strconv.ParseUint(key[:strings.IndexByte(key, '/')], 10, 64)
+			if removed[c] || (err == nil && removed[pid]) {
+				removed[c] = true
+				delete(dc.Dirs, key)
+				dc.changed = true
+				changed = true
+			}
+		}
+	}
+	if *verbose {
+		log.Printf("删除文件夹 %d 的缓存", cid)
+	}
+}
+
+// 判断缓存里的文件夹是否还存在，每次运行只检查一次，避免文件夹在网页端被删除后一直上传到不存在的文件夹
+func (dc *dirCacheData) verify(cid uint64) (bool, error) {
+	dc.mu.Lock()
+	checked := dc.checked[cid]
+	dc.mu.Unlock()
+	if checked {
+		return true, nil
+	}
+
+	exists, err := dc.exists(cid)
+	if err != nil || !exists {
+		return false, err
+	}
+	dc.mu.Lock()
+	dc.checked[cid] = true
+	dc.mu.Unlock()
+	return true, nil
+}
+
+// 保存文件夹缓存到文件
+func (dc *dirCacheData) save() {
+	if dc == nil {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if !dc.changed {
+		return
+	}
+	if err := writeJSONFile(dc.file, dc); err != nil {
+		log.Printf("保存文件夹缓存文件 %s 出现错误：%v", dc.file, err)
+		return
+	}
+	dc.changed = false
+}
+
+// 判断 115 网盘里是否存在 cid 对应的文件夹
+func dirExists(cid uint64) (bool, error) {
+	if cid == 0 {
+		return true, nil
+	}
+	v, err := getURLJSON(fmt.Sprintf(listFileURL, cid, 1))
+	if err != nil {
+		return false, err
+	}
+	return v.GetBool("state"), nil
+}
+
+// 优先使用缓存里的文件夹，没有缓存时在 115 网盘的 pid 文件夹里创建文件夹，
+// pid 对应的文件夹不存在时删除其缓存并返回 errDirNotFound
+func cachedCreateDir(pid uint64, name string) (uint64, error) {
+	if cid, ok := dirCache.get(pid, name); ok {
+		exists, err := dirCache.verify(cid)
+		if err != nil {
+			return 0, fmt.Errorf("检查缓存的文件夹 %s 是否存在出现错误：%w", name, err)
+		}
+		if exists {
+			if *verbose {
+				log.Printf("使用文件夹 %s 的缓存，cid：%d", name, cid)
+			}
+			return cid, nil
+		}
+		log.Printf("缓存的文件夹 %s（cid：%d）已经不存在，重新创建文件夹", name, cid)
+		dirCache.invalidate(cid)
+	}
+
+	// 等待一秒
+	time.Sleep(time.Second)
+
+	cid, err := createDir(pid, name)
+	if err != nil {
+		if errors.Is(err, errDirNotFound) {
+			dirCache.invalidate(pid)
+		}
+		return 0, err
+	}
+	dirCache.put(pid, name, cid)
+
+	return cid, nil
+}
+
+// 按路径在 115 网盘里查找或创建文件夹，以 / 开头的路径从根目录开始，否则从 root 文件夹开始
+type remoteDirs struct {
+	root uint64            // 相对路径的起始文件夹的 cid
+	dirs map[string]uint64 // 已经创建的文件夹的路径对应的 cid
+}
+
+func newRemoteDirs(root uint64) *remoteDirs {
+	return &remoteDirs{root: root, dirs: make(map[string]uint64)}
+}
+
+// 创建 dir 文件夹及其还没创建的上级文件夹，返回文件夹的 cid
+func (rd *remoteDirs) create(dir string) (uint64, error) {
+	dir = path.Clean(dir)
+	switch dir {
+	case "/":
+		return 0, nil
+	case ".":
+		return rd.root, nil
+	}
+	if cid, ok := rd.dirs[dir]; ok {
+		return cid, nil
+	}
+
+	pdir, name := path.Dir(dir), path.Base(dir)
+	pid, err := rd.create(pdir)
+	if err != nil {
+		return 0, err
+	}
+	cid, err := cachedCreateDir(pid, name)
+	if errors.Is(err, errDirNotFound) && pdir != "/" && pdir != "." {
+		// 缓存的上级文件夹已经不存在，重新创建上级文件夹
+		delete(rd.dirs, pdir)
+		if pid, err = rd.create(pdir); err != nil {
+			return 0, err
+		}
+		cid, err = cachedCreateDir(pid, name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	rd.dirs[dir] = cid
+
+	return cid, nil
+}
+
+// 只从缓存里查找 dir 文件夹的 cid，不创建文件夹
+func (rd *remoteDirs) lookup(dir string) (cid uint64, ok bool) {
+	dir = path.Clean(dir)
+	switch dir {
+	case "/":
+		return 0, true
+	case ".":
+		return rd.root, true
+	}
+	if cid, ok := rd.dirs[dir]; ok {
+		return cid, true
+	}
+
+	pid, ok := rd.lookup(path.Dir(dir))
+	if !ok {
+		return 0, false
+	}
+	return dirCache.get(pid, path.Base(dir))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDirCache(t *testing.T) {
+	verbose = new(bool)
+	file := filepath.Join(t.TempDir(), "dirs.json")
+	dc, err := loadDirCache(file)
+	if err != nil {
+		t.Fatalf("load dir cache error: %v", err)
+	}
+	dc.put(0, "a", 1)
+	dc.put(1, "b", 2)
+	dc.put(2, "c", 3)
+	dc.put(0, "d", 4)
+	dc.save()
+
+	dc, err = loadDirCache(file)
+	if err != nil {
+		t.Fatalf("load dir cache error: %v", err)
+	}
+	if cid, ok := dc.get(1, "b"); !ok || cid != 2 {
+		t.Errorf("cid of b want: 2, result: %d", cid)
+	}
+
+	// 删除文件夹 a 的缓存时同时删除其子文件夹的缓存
+	dc.invalidate(1)
+	for _, key := range []string{dirKey(0, "a"), dirKey(1, "b"), dirKey(2, "c")} {
+		if _, ok := dc.Dirs[key]; ok {
+			t.Errorf("%s should be invalidated", key)
+		}
+	}
+	if cid, ok := dc.get(0, "d"); !ok || cid != 4 {
+		t.Errorf("cid of d want: 4, result: %d", cid)
+	}
+}
+
+func TestDirCacheVerify(t *testing.T) {
+	verbose = new(bool)
+	dc := newDirCache(filepath.Join(t.TempDir(), "dirs.json"))
+	dc.put(0, "a", 1)
+	dc.put(0, "deleted", 2)
+	checks := make(map[uint64]int)
+	dc.exists = func(cid uint64) (bool, error) {
+		checks[cid]++
+		return cid != 2, nil
+	}
+	defer func(dc *dirCacheData) { dirCache = dc }(dirCache)
+	dirCache = dc
+
+	// 存在的文件夹每次运行只检查一次
+	for i := 0; i < 3; i++ {
+		cid, err := cachedCreateDir(0, "a")
+		if err != nil || cid != 1 {
+			t.Fatalf("cachedCreateDir() want: 1, result: %d, error: %v", cid, err)
+		}
+	}
+	if checks[1] != 1 {
+		t.Errorf("existing folder should be checked once, result: %d", checks[1])
+	}
+
+	// 不存在的文件夹每次都检查，不会当作已确认
+	for i := 0; i < 2; i++ {
+		if exists, err := dc.verify(2); err != nil || exists {
+			t.Errorf("deleted folder should not exist, result: %v, error: %v", exists, err)
+		}
+	}
+	if checks[2] != 2 {
+		t.Errorf("deleted folder should be checked every time, result: %d", checks[2])
+	}
+}
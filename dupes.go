@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 保留重复文件的规则
+const (
+	keepOldest   = "oldest"   // 保留最早上传的文件
+	keepShortest = "shortest" // 保留路径最短的文件
+)
+
+var (
+	dupesKeep   *string // 保留重复文件的规则
+	dupesDelete *bool   // 删除多余的重复文件
+	dupesMove   *string // 将多余的重复文件移动到指定文件夹
+	confirm     *bool   // 确认执行删除或移动操作
+)
+
+// 一组 sha1 和大小都一样的文件
+type dupeGroup struct {
+	SHA1   string       `json:"sha1"`   // 文件的 sha1 值
+	Size   int64        `json:"size"`   // 文件大小
+	Keep   remoteFile   `json:"keep"`   // 保留的文件
+	Extras []remoteFile `json:"extras"` // 多余的文件
+}
+
+// 将文件按 sha1 和大小分组，按照保留规则选出每组保留的文件，只返回有重复文件的组
+func findDupes(files []remoteFile, keep string) []dupeGroup {
+	groups := make(map[string][]remoteFile)
+	for _, file := range files {
+		if file.SHA1 == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s-%d", strings.ToUpper(file.SHA1), file.Size)
+		groups[key] = append(groups[key], file)
+	}
+
+	var dupes []dupeGroup
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			a, b := group[i], group[j]
+			if keep == keepShortest {
+				if la, lb := utf8.RuneCountInString(a.Path), utf8.RuneCountInString(b.Path); la != lb {
+					return la < lb
+				}
+			} else if a.Time != b.Time {
+				return a.Time < b.Time
+			}
+			return a.Path < b.Path
+		})
+		dupes = append(dupes, dupeGroup{
+			SHA1:   strings.ToUpper(group[0].SHA1),
+			Size:   group[0].Size,
+			Keep:   group[0],
+			Extras: group[1:],
+		})
+	}
+	// 浪费空间最多的组排在前面
+	sort.Slice(dupes, func(i, j int) bool {
+		wi := dupes[i].Size * int64(len(dupes[i].Extras))
+		wj := dupes[j].Size * int64(len(dupes[j].Extras))
+		if wi != wj {
+			return wi > wj
+		}
+		return dupes[i].Keep.Path < dupes[j].Keep.Path
+	})
+
+	return dupes
+}
+
+// 删除或移动多余的重复文件
+func removeDupes(dupes []dupeGroup, target uint64) error {
+	// 按所在的文件夹批量操作
+	byDir := make(map[uint64][]string)
+	for _, group := range dupes {
+		for _, file := range group.Extras {
+			byDir[file.CID] = append(byDir[file.CID], file.FID)
+		}
+	}
+
+	var errs []error
+	for pid, ids := range byDir {
+		var err error
+		if *dupesMove != "" {
+			log.Printf("将文件夹 %d 里的 %d 个重复文件移动到文件夹 %d", pid, len(ids), target)
+			err = moveRemote(target, ids...)
+		} else {
+			log.Printf("删除文件夹 %d 里的 %d 个重复文件", pid, len(ids))
+			err = deleteRemote(pid, ids...)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("处理文件夹 %d 里的重复文件出现错误：%w", pid, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// dupes 子命令，按 sha1 查找 115 文件夹里的重复文件
+func dupesCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("用法：dupes 115文件夹的cid或路径")
+	}
+	if *dupesKeep != keepOldest && *dupesKeep != keepShortest {
+		return fmt.Errorf("不支持的保留规则 %s ，只支持 %s 和 %s", *dupesKeep, keepOldest, keepShortest)
+	}
+	if *dupesDelete && *dupesMove != "" {
+		return errors.New("-dupes-delete 和 -dupes-move 参数只能同时使用其中一个")
+	}
+	cid, err := resolveRemoteDir(args[0])
+	if err != nil {
+		return err
+	}
+	var target uint64
+	if *dupesMove != "" {
+		if target, err = resolveRemoteDir(*dupesMove); err != nil {
+			return err
+		}
+	}
+
+	var files []remoteFile
+	err = walkRemote(cid, func(dir string, pid uint64, file remoteFile) {
+		files = append(files, file)
+	})
+	if err != nil {
+		return err
+	}
+	dupes := findDupes(files, *dupesKeep)
+
+	if *jsonOutput {
+		if dupes == nil {
+			dupes = []dupeGroup{}
+		}
+		if err := printJSON(dupes); err != nil {
+			return err
+		}
+	} else {
+		var wasted int64
+		extras := 0
+		for _, group := range dupes {
+			fmt.Printf("%s %s\n", group.SHA1, formatSize(group.Size))
+			fmt.Printf("  保留：%s\n", group.Keep.Path)
+			for _, file := range group.Extras {
+				fmt.Printf("  多余：%s\n", file.Path)
+			}
+			wasted += group.Size * int64(len(group.Extras))
+			extras += len(group.Extras)
+		}
+		fmt.Printf("共有 %d 组重复文件，多余的文件有 %d 个，占用 %s\n", len(dupes), extras, formatSize(wasted))
+	}
+
+	if len(dupes) == 0 || (!*dupesDelete && *dupesMove == "") {
+		return nil
+	}
+	if !*confirm {
+		log.Println("没有删除或移动文件，确认要处理多余的重复文件时请加上参数 -confirm")
+		return nil
+	}
+	return removeDupes(dupes, target)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestFindDupes(t *testing.T) {
+	files := []remoteFile{
+		{FID: "1", Path: "a/long/name.mp4", SHA1: "aaaa", Size: 10, Time: 100},
+		{FID: "2", Path: "b.mp4", SHA1: "AAAA", Size: 10, Time: 200},
+		{FID: "3", Path: "c/name.mp4", SHA1: "aaaa", Size: 10, Time: 50},
+		{FID: "4", Path: "d.mp4", SHA1: "bbbb", Size: 20, Time: 10},
+		{FID: "5", Path: "e.mp4", SHA1: "aaaa", Size: 11, Time: 10},
+	}
+
+	dupes := findDupes(files, keepOldest)
+	if len(dupes) != 1 || len(dupes[0].Extras) != 2 {
+		t.Fatalf("dupes want 1 group with 2 extras, result: %+v", dupes)
+	}
+	if dupes[0].Keep.FID != "3" {
+		t.Errorf("oldest kept file want: 3, result: %s", dupes[0].Keep.FID)
+	}
+
+	dupes = findDupes(files, keepShortest)
+	if dupes[0].Keep.FID != "2" {
+		t.Errorf("shortest kept file want: 2, result: %s", dupes[0].Keep.FID)
+	}
+}
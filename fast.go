@@ -14,8 +14,10 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/valyala/fastjson"
 )
 
@@ -46,6 +48,19 @@ type fastToken struct {
 	Object     string   `json:"object"`
 	Callback   callback `json:"callback"`
 	SHA1       string   // 文件的 sha1 hash 值
+	Name       string   // 上传后的文件名
+	Start      int64    // 开始上传的时间（秒）
+	PartsMD5   []string // 每个分片的 md5 值（base64 编码），为空时不校验
+	CRC64      uint64   // 文件的 crc64 值，为 0 时不校验
+}
+
+// 文件要上传到的文件夹的 cid
+func (ft *fastToken) targetCID() uint64 {
+	cid, err := strconv.ParseUint(strings.TrimPrefix(ft.Target, targetPrefix), 10, 64)
+	if err != nil {
+		return config.CID
+	}
+	return cid
 }
 
 const md5Salt = "Qclm8MGWUv59TnrR0XPg"
@@ -125,11 +140,11 @@ func uploadSHA1(filename, fileSize, totalHash, signKey, signVal string, targetCI
 	return decrypted, nil
 }
 
-// 利用文件的 sha1 hash 值上传文件获取响应
-func (file *fileInfo) uploadFileSHA1() (body []byte, fileSHA1 string, e error) {
+// 计算要上传的文件的 hash 值，read 不为 nil 时记录已经读取的数据大小
+func (file *fileInfo) computeHash(progress bool, read *atomic.Int64) (fh *fileHash, e error) {
 	defer func() {
 		if err := recover(); err != nil {
-			e = fmt.Errorf("uploadFileSHA1() error: %v", err)
+			e = fmt.Errorf("computeHash() error: %v", err)
 		}
 	}()
 
@@ -137,12 +152,42 @@ func (file *fileInfo) uploadFileSHA1() (body []byte, fileSHA1 string, e error) {
 	checkErr(err)
 	defer f.Close()
 
-	_, totalHash, err := hashSHA1(f)
+	info, err := f.Stat()
+	checkErr(err)
+
+	var chunks []oss.FileChunk
+	if *checkHash && willMultipart(file.mode(), info.Size()) {
+		chunks, err = splitFile(file.Path, info.Size())
+		checkErr(err)
+	}
+	fh, err = cachedHashFile(f, *checkHash, chunks, progress, read)
 	checkErr(err)
 
+	return fh, nil
+}
+
+// 利用文件的 sha1 hash 值上传文件获取响应
+func (file *fileInfo) uploadFileSHA1() (body []byte, fh *fileHash, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("uploadFileSHA1() error: %v", err)
+		}
+	}()
+
+	fh, err := file.getHash()
+	checkErr(err)
+	file.sha1 = fh.TotalHash
+
+	f, err := os.Open(file.Path)
+	checkErr(err)
+	defer f.Close()
+
 	info, err := os.Stat(file.Path)
 	checkErr(err)
-	filename := info.Name()
+
+	totalHash := fh.TotalHash
+	filename := file.remoteName(info)
+	file.name = filename
 	fileSize := strconv.FormatInt(info.Size(), 10)
 	targetCID := file.ParentID
 
@@ -166,7 +211,7 @@ func (file *fileInfo) uploadFileSHA1() (body []byte, fileSHA1 string, e error) {
 		checkErr(err)
 	}
 
-	return body, totalHash, nil
+	return body, fh, nil
 }
 
 // 以秒传模式上传文件
@@ -180,9 +225,11 @@ func (file *fileInfo) fastUploadFile() (token *fastToken, e error) {
 	token = new(fastToken)
 	log.Println("秒传模式上传文件：" + file.Path)
 
-	body, fileSHA1, err := file.uploadFileSHA1()
+	body, fh, err := file.uploadFileSHA1()
 	checkErr(err)
-	token.SHA1 = fileSHA1
+	token.SHA1 = fh.TotalHash
+	token.PartsMD5 = fh.PartsMD5
+	token.CRC64 = fh.CRC64
 
 	if *verbose {
 		log.Printf("秒传模式上传文件 %s 的响应体的内容是：\n%s", file.Path, string(body))
@@ -193,14 +240,12 @@ func (file *fileInfo) fastUploadFile() (token *fastToken, e error) {
 	checkErr(err)
 	if v.GetInt("status") == 2 && v.Exists("statuscode") && v.GetInt("statuscode") == 0 {
 		log.Printf("秒传模式上传 %s 成功", file.Path)
-		if *removeFile {
-			err = remove(file.Path)
-			checkErr(err)
-		}
 	} else if v.GetInt("status") == 1 && v.Exists("statuscode") && v.GetInt("statuscode") == 0 {
 		// 秒传失败的响应包含普通上传模式和断点续传模式的 token
 		err = json.Unmarshal(body, &token)
 		checkErr(err)
+		token.Name = file.name
+		token.Start = file.start
 
 		if *verbose {
 			log.Printf("秒传模式上传 %s 失败返回的内容是：\n%+v", file.Path, token)
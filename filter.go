@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// 每个文件夹里的忽略规则文件，语法和 .gitignore 一样
+const ignoreFile = ".115ignore"
+
+// 可以多次指定的参数
+type stringsFlag []string
+
+// 实现 flag.Value 的接口
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// 实现 flag.Value 的接口
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// 递归上传文件夹时的过滤条件
+type filterOptions struct {
+	include       stringsFlag // 只上传匹配的文件
+	exclude       stringsFlag // 不上传匹配的文件和文件夹
+	minSize       int64       // 文件大小的下限，为 0 时不限制
+	maxSize       int64       // 文件大小的上限，为 0 时不限制
+	modifiedSince time.Time   // 只上传在这之后修改过的文件
+	skipHidden    bool        // 不上传隐藏文件和隐藏文件夹
+}
+
+var filterOpts filterOptions
+
+// 解析文件大小，支持 K、M、G、T 单位
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	unit := int64(1)
+	if s != "" {
+		if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+			unit = int64(1) << (10 * (i + 1))
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无法解析文件大小 %s", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// 解析时间，支持日期、日期时间和相对现在的时长
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %s", s)
+}
+
+// .115ignore 里的一条规则
+type ignoreRule struct {
+	base     string // 规则文件所在的文件夹
+	pattern  string
+	negate   bool // 以 ! 开头，重新包含匹配的文件
+	dirOnly  bool // 以 / 结尾，只匹配文件夹
+	anchored bool // 包含 / ，相对规则文件所在的文件夹匹配
+}
+
+// 匹配规则，rel 是相对规则文件所在文件夹的路径
+func (rule *ignoreRule) match(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if rule.anchored {
+		ok, _ := doublestar.Match(rule.pattern, rel)
+		return ok
+	}
+	ok, _ := doublestar.Match(rule.pattern, path.Base(rel))
+	return ok
+}
+
+// 读取文件夹里的 .115ignore
+func readIgnoreFile(dir string) ([]ignoreRule, error) {
+	f, err := os.Open(filepath.Join(dir, ignoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" || !doublestar.ValidatePattern(line) {
+			log.Printf("忽略 %s 里无效的规则：%s", filepath.Join(dir, ignoreFile), scanner.Text())
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// 递归遍历一个文件夹时使用的过滤器
+type walkFilter struct {
+	root  string
+	rules map[string][]ignoreRule // 每个文件夹的 .115ignore 规则
+}
+
+// 新建遍历 root 文件夹的过滤器
+func newWalkFilter(root string) *walkFilter {
+	return &walkFilter{root: root, rules: make(map[string][]ignoreRule)}
+}
+
+// 按 -include 和 -exclude 的模式匹配，没有 / 的模式匹配文件名，否则匹配相对遍历的文件夹的路径
+func matchPatterns(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据 .115ignore 的规则判断是否忽略，后面的规则优先
+func (wf *walkFilter) ignored(p string, isDir bool) bool {
+	var dirs []string
+	for dir := filepath.Dir(p); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == wf.root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, rule := range wf.rules[dirs[i]] {
+			rel, err := filepath.Rel(rule.base, p)
+			if err != nil {
+				continue
+			}
+			if rule.match(filepath.ToSlash(rel), isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// 判断是否跳过文件夹，不跳过时读取文件夹里的 .115ignore
+func (wf *walkFilter) skipDir(p string, d fs.DirEntry) (reason string, skip bool) {
+	if p != wf.root {
+		rel, err := filepath.Rel(wf.root, p)
+		if err != nil {
+			return err.Error(), true
+		}
+		rel = filepath.ToSlash(rel)
+		if filterOpts.skipHidden && isHidden(p, d) {
+			return "隐藏文件夹", true
+		}
+		if matchPatterns(filterOpts.exclude, rel) {
+			return "匹配 -exclude", true
+		}
+		if wf.ignored(p, true) {
+			return "匹配 " + ignoreFile, true
+		}
+	}
+
+	rules, err := readIgnoreFile(p)
+	if err != nil {
+		log.Printf("读取 %s 出现错误：%v", filepath.Join(p, ignoreFile), err)
+	}
+	wf.rules[p] = rules
+	return "", false
+}
+
+// 判断是否跳过文件
+func (wf *walkFilter) skipFile(p string, d fs.DirEntry) (reason string, skip bool) {
+	if d.Name() == ignoreFile {
+		return ignoreFile, true
+	}
+	rel, err := filepath.Rel(wf.root, p)
+	if err != nil {
+		return err.Error(), true
+	}
+	rel = filepath.ToSlash(rel)
+	if filterOpts.skipHidden && isHidden(p, d) {
+		return "隐藏文件", true
+	}
+	if len(filterOpts.include) != 0 && !matchPatterns(filterOpts.include, rel) {
+		return "不匹配 -include", true
+	}
+	if matchPatterns(filterOpts.exclude, rel) {
+		return "匹配 -exclude", true
+	}
+	if wf.ignored(p, false) {
+		return "匹配 " + ignoreFile, true
+	}
+
+	if filterOpts.minSize != 0 || filterOpts.maxSize != 0 || !filterOpts.modifiedSince.IsZero() {
+		info, err := d.Info()
+		if err != nil {
+			return err.Error(), true
+		}
+		if filterOpts.minSize != 0 && info.Size() < filterOpts.minSize {
+			return "小于 -min-size", true
+		}
+		if filterOpts.maxSize != 0 && info.Size() > filterOpts.maxSize {
+			return "大于 -max-size", true
+		}
+		if !filterOpts.modifiedSince.IsZero() && info.ModTime().Before(filterOpts.modifiedSince) {
+			return "早于 -modified-since", true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"100":  100,
+		"1K":   1024,
+		"1.5m": 1536 * 1024,
+		"2GB":  2 * 1024 * 1024 * 1024,
+	}
+	for s, want := range tests {
+		size, err := parseSize(s)
+		if err != nil {
+			t.Errorf("parse size %s error: %v", s, err)
+		}
+		if size != want {
+			t.Errorf("size of %s want: %d, result: %d", s, want, size)
+		}
+	}
+	if _, err := parseSize("abc"); err == nil {
+		t.Error("parse size abc should fail")
+	}
+}
+
+func TestWalkFilter(t *testing.T) {
+	verbose = new(bool)
+	filterOpts = filterOptions{exclude: stringsFlag{"*.tmp"}}
+	defer func() {
+		filterOpts = filterOptions{}
+	}()
+
+	root := t.TempDir()
+	files := map[string]string{
+		ignoreFile:                      "*.log\n!keep.log\nbuild/\n/top.txt\n",
+		"a.txt":                         "",
+		"a.tmp":                         "",
+		"top.txt":                       "",
+		"debug.log":                     "",
+		"keep.log":                      "",
+		"sub/top.txt":                   "",
+		"sub/error.log":                 "",
+		"sub/" + ignoreFile:             "!error.log\n",
+		"build/out.bin":                 "",
+		"sub/build/out.bin":             "",
+		"sub/deep/" + ignoreFile + ".x": "",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var uploaded []string
+	filter := newWalkFilter(root)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if _, skip := filter.skipDir(path, d); skip {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if _, skip := filter.skipFile(path, d); !skip {
+			rel, _ := filepath.Rel(root, path)
+			uploaded = append(uploaded, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a.txt", "keep.log", "sub/deep/" + ignoreFile + ".x", "sub/error.log", "sub/top.txt"}
+	if len(uploaded) != len(want) {
+		t.Fatalf("uploaded files want: %v, result: %v", want, uploaded)
+	}
+	for i := range want {
+		if uploaded[i] != want[i] {
+			t.Errorf("uploaded files want: %v, result: %v", want, uploaded)
+			break
+		}
+	}
+}
@@ -8,6 +8,7 @@ require (
 	github.com/aead/ecdh v0.2.0
 	github.com/aliyun/aliyun-oss-go-sdk v3.0.2+incompatible
 	github.com/andreburgaud/crypt2go v1.8.0
+	github.com/bmatcuk/doublestar/v4 v4.10.2
 	github.com/cheggaaa/pb/v3 v3.1.5
 	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203
 	github.com/pierrec/lz4/v4 v4.1.21
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"crypto/md5"
 	"crypto/sha1"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc64"
 	"io"
 	"os"
 	"strings"
+	"sync/atomic"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/cheggaaa/pb/v3"
 )
 
 // 计算文件指定范围内的 sha1 值
@@ -27,34 +36,158 @@ func hashFileRange(f *os.File, signCheck string) (rangeHash string, e error) {
 	_, err = f.Seek(start, io.SeekStart)
 	checkErr(err)
 	h := sha1.New()
+	// 范围超出文件大小（例如空文件）时只计算文件里有的数据
 	_, err = io.CopyN(h, f, end-start+1)
-	checkErr(err)
+	if err != nil && !errors.Is(err, io.EOF) {
+		panic(err)
+	}
 
 	return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
 }
 
-// 计算文件的 sha1 值
-func hashSHA1(f *os.File) (blockHash, totalHash string, e error) {
+const (
+	hashBarSize = 100 * 1024 * 1024                          // 显示计算 hash 值进度条的文件大小下限
+	emptySHA1   = "DA39A3EE5E6B4B0D3255BFEF95601890AFD80709" // 空文件的 sha1 值
+)
+
+// 文件的 hash 值
+type fileHash struct {
+	BlockHash string   // 文件最前面一个区块的 sha1 值
+	TotalHash string   // 整个文件的 sha1 值
+	PartsMD5  []string // 每个分片的 md5 值（base64 编码）
+	PartSize  int64    // 计算 PartsMD5 时每个分片的大小
+	CRC64     uint64   // 整个文件的 crc64 值
+}
+
+// 是否已经有 -check-hash 校验 chunks 需要的 crc64 值和分片的 md5 值
+func (fh *fileHash) hasVerifyData(chunks []oss.FileChunk) bool {
+	if fh.CRC64 == 0 {
+		return false
+	}
+	return len(chunks) == 0 || (len(fh.PartsMD5) == len(chunks) && fh.PartSize == chunks[0].Size)
+}
+
+// 依次计算每个分片的 md5 值
+type partsWriter struct {
+	chunks []oss.FileChunk
+	sums   []string
+	h      hash.Hash
+	index  int   // 正在计算的分片
+	offset int64 // 已写入的数据的大小
+}
+
+// 实现 io.Writer 的接口
+func (w *partsWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	for len(p) != 0 && w.index < len(w.chunks) {
+		chunk := w.chunks[w.index]
+		l := chunk.Offset + chunk.Size - w.offset
+		if int64(len(p)) < l {
+			l = int64(len(p))
+		}
+		w.h.Write(p[:l])
+		p = p[l:]
+		w.offset += l
+		if w.offset == chunk.Offset+chunk.Size {
+			w.sums = append(w.sums, base64.StdEncoding.EncodeToString(w.h.Sum(nil)))
+			w.h.Reset()
+			w.index++
+		}
+	}
+	return n, nil
+}
+
+// 只读取一次文件计算文件的 hash 值，verify 为 true 时同时计算 crc64 值和 chunks 里每个分片的 md5 值，
+// progress 为 true 时较大的文件显示进度条
+func hashFile(f *os.File, verify bool, chunks []oss.FileChunk, progress bool) (fh *fileHash, e error) {
+	return sumFile(f, true, verify, chunks, progress, nil)
+}
+
+// 记录已经读取的数据大小
+type countingReader struct {
+	r    io.Reader
+	read *atomic.Int64
+}
+
+// 实现 io.Reader 的接口
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.read.Add(int64(n))
+	return n, err
+}
+
+// 读取一次文件，sha 为 true 时计算 sha1 值，verify 为 true 时计算 crc64 值和 chunks 里每个分片的 md5 值，
+// read 不为 nil 时记录已经读取的数据大小
+func sumFile(f *os.File, sha, verify bool, chunks []oss.FileChunk, progress bool, read *atomic.Int64) (fh *fileHash, e error) {
 	defer func() {
 		if err := recover(); err != nil {
-			e = fmt.Errorf("hashSHA1() error: %v", err)
+			e = fmt.Errorf("hashFile() error: %v", err)
 		}
 	}()
 
-	// 计算文件最前面一个区块的 sha1 hash 值
-	block := make([]byte, 128*1024)
-	n, err := f.Read(block)
+	info, err := f.Stat()
 	checkErr(err)
-	data := sha1.Sum(block[:n])
-	blockHash = strings.ToUpper(hex.EncodeToString(data[:]))
+	if info.Size() == 0 {
+		if !sha {
+			return &fileHash{}, nil
+		}
+		return &fileHash{BlockHash: emptySHA1, TotalHash: emptySHA1}, nil
+	}
 	_, err = f.Seek(0, io.SeekStart)
 	checkErr(err)
 
-	// 计算整个文件的 sha1 hash 值
-	h := sha1.New()
-	_, err = io.Copy(h, f)
+	var r io.Reader = f
+	if read != nil {
+		r = &countingReader{r: f, read: read}
+	}
+	if progress && info.Size() >= hashBarSize {
+		hashBar := pb.New64(info.Size()).SetTemplate(pb.Full).Set(pb.Bytes, true).Set("prefix", "计算 hash 值").Start()
+		defer hashBar.Finish()
+		r = hashBar.NewProxyReader(r)
+	}
+
+	// 文件最前面一个区块的 sha1 hash 值
+	blockH := sha1.New()
+	totalH := sha1.New()
+	var writers []io.Writer
+	if sha {
+		writers = append(writers, totalH)
+	}
+	var crcH hash.Hash64
+	var pw *partsWriter
+	if verify {
+		crcH = crc64.New(crc64.MakeTable(crc64.ECMA))
+		writers = append(writers, crcH)
+		if len(chunks) != 0 {
+			pw = &partsWriter{chunks: chunks, h: md5.New()}
+			writers = append(writers, pw)
+		}
+	}
+
+	block := make([]byte, 128*1024)
+	n, err := io.ReadFull(r, block)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		panic(err)
+	}
+	blockH.Write(block[:n])
+	w := io.MultiWriter(writers...)
+	_, err = w.Write(block[:n])
 	checkErr(err)
-	totalHash = strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	_, err = io.Copy(w, r)
+	checkErr(err)
+
+	fh = new(fileHash)
+	if sha {
+		fh.BlockHash = strings.ToUpper(hex.EncodeToString(blockH.Sum(nil)))
+		fh.TotalHash = strings.ToUpper(hex.EncodeToString(totalH.Sum(nil)))
+	}
+	if crcH != nil {
+		fh.CRC64 = crcH.Sum64()
+	}
+	if pw != nil {
+		fh.PartsMD5 = pw.sums
+		fh.PartSize = chunks[0].Size
+	}
 
-	return blockHash, totalHash, nil
+	return fh, nil
 }
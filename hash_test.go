@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"hash/crc64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 新建指定内容的临时文件
+func tempFile(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+	})
+	return f
+}
+
+func TestHashFileEmpty(t *testing.T) {
+	f := tempFile(t, nil)
+	fh, err := hashFile(f, true, nil, false)
+	if err != nil {
+		t.Fatalf("hash empty file error: %v", err)
+	}
+	sum := sha1.Sum(nil)
+	if want := strings.ToUpper(hex.EncodeToString(sum[:])); want != emptySHA1 {
+		t.Errorf("empty sha1 want: %s, result: %s", want, emptySHA1)
+	}
+	if fh.TotalHash != emptySHA1 || fh.BlockHash != emptySHA1 {
+		t.Errorf("empty file hash want: %s, result: %+v", emptySHA1, fh)
+	}
+
+	rangeHash, err := hashFileRange(f, "0-0")
+	if err != nil {
+		t.Fatalf("hash range of empty file error: %v", err)
+	}
+	if rangeHash != emptySHA1 {
+		t.Errorf("range hash of empty file want: %s, result: %s", emptySHA1, rangeHash)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	data := make([]byte, 1000*1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	f := tempFile(t, data)
+	chunks, err := oss.SplitFileByPartNum(f.Name(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh, err := hashFile(f, true, chunks, false)
+	if err != nil {
+		t.Fatalf("hash file error: %v", err)
+	}
+
+	sum := sha1.Sum(data)
+	if want := strings.ToUpper(hex.EncodeToString(sum[:])); fh.TotalHash != want {
+		t.Errorf("total hash want: %s, result: %s", want, fh.TotalHash)
+	}
+	sum = sha1.Sum(data[:128*1024])
+	if want := strings.ToUpper(hex.EncodeToString(sum[:])); fh.BlockHash != want {
+		t.Errorf("block hash want: %s, result: %s", want, fh.BlockHash)
+	}
+	if want := crc64.Checksum(data, crc64.MakeTable(crc64.ECMA)); fh.CRC64 != want {
+		t.Errorf("crc64 want: %d, result: %d", want, fh.CRC64)
+	}
+	if len(fh.PartsMD5) != len(chunks) {
+		t.Fatalf("parts md5 number want: %d, result: %d", len(chunks), len(fh.PartsMD5))
+	}
+	for i, chunk := range chunks {
+		sum := md5.Sum(data[chunk.Offset : chunk.Offset+chunk.Size])
+		if want := base64.StdEncoding.EncodeToString(sum[:]); fh.PartsMD5[i] != want {
+			t.Errorf("md5 of part %d want: %s, result: %s", chunk.Number, want, fh.PartsMD5[i])
+		}
+	}
+}
+
+func TestHashFileSmall(t *testing.T) {
+	data := []byte("fake115uploader")
+	f := tempFile(t, data)
+	fh, err := hashFile(f, false, nil, false)
+	if err != nil {
+		t.Fatalf("hash file error: %v", err)
+	}
+	sum := sha1.Sum(data)
+	want := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if fh.TotalHash != want || fh.BlockHash != want {
+		t.Errorf("hash of small file want: %s, result: %+v", want, fh)
+	}
+}
+
+func TestSumFileRead(t *testing.T) {
+	data := []byte(strings.Repeat("fake115uploader", 20000))
+	f := tempFile(t, data)
+	read := new(atomic.Int64)
+	fh, err := sumFile(f, true, false, nil, false, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := read.Load(); n != int64(len(data)) {
+		t.Errorf("read size want: %d, result: %d", len(data), n)
+	}
+	sum := sha1.Sum(data)
+	if want := strings.ToUpper(hex.EncodeToString(sum[:])); fh.TotalHash != want {
+		t.Errorf("sha1 want: %s, result: %s", want, fh.TotalHash)
+	}
+
+	// 只计算校验需要的值时不计算 sha1 值
+	fh, err = sumFile(f, false, true, nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fh.TotalHash != "" || fh.CRC64 != crc64.Checksum(data, crc64.MakeTable(crc64.ECMA)) {
+		t.Errorf("checksum only result: %+v", fh)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// 判断是否隐藏文件，以 . 开头的文件为隐藏文件
+func isHidden(path string, d fs.DirEntry) bool {
+	return strings.HasPrefix(d.Name(), ".")
+}
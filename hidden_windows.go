@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import (
+	"io/fs"
+	"strings"
+	"syscall"
+)
+
+// 判断是否隐藏文件，以 . 开头或者带有隐藏属性
+func isHidden(path string, d fs.DirEntry) bool {
+	if strings.HasPrefix(d.Name(), ".") {
+		return true
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+	}
+	return false
+}
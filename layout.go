@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+var dateLayout string // 按文件修改时间分配 115 文件夹的路径模板，为空时不按日期分配
+
+// 路径模板支持的变量对应的时间格式
+var layoutFormats = map[string]string{
+	"{yyyy}": "2006",
+	"{yy}":   "06",
+	"{mm}":   "01",
+	"{dd}":   "02",
+}
+
+// 检查路径模板里的变量是否都支持
+func checkLayout(layout string) error {
+	vars := templateVar.FindAllString(layout, -1)
+	if len(vars) == 0 {
+		return fmt.Errorf("路径模板 %s 里没有日期变量", layout)
+	}
+	for _, v := range vars {
+		if _, ok := layoutFormats[v]; !ok {
+			return fmt.Errorf("路径模板 %s 里的变量 %s 不支持", layout, v)
+		}
+	}
+	return nil
+}
+
+// 根据文件的修改时间生成文件要上传到的文件夹的路径
+func layoutDir(layout string, info os.FileInfo) string {
+	t := info.ModTime()
+	return templateVar.ReplaceAllStringFunc(layout, func(v string) string {
+		return t.Format(layoutFormats[v])
+	})
+}
+
+// 按照文件的修改时间设置文件要上传到的文件夹，需要时在 115 创建文件夹，返回设置成功的文件
+func applyDateLayout(files []fileInfo) []fileInfo {
+	dirs := newRemoteDirs(config.CID)
+	layout := strings.ReplaceAll(dateLayout, `\`, "/")
+	laid := files[:0]
+	for _, file := range files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			log.Printf("获取文件 %s 的信息出现错误：%v", file.Path, err)
+			result.Failed = append(result.Failed, file.Path)
+			continue
+		}
+		if err := file.setRemoteDir(dirs, layoutDir(layout, info)); err != nil {
+			log.Printf("取消上传 %s ：%v", file.Path, err)
+			result.Failed = append(result.Failed, file.Path)
+			continue
+		}
+		laid = append(laid, file)
+	}
+
+	return laid
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckLayout(t *testing.T) {
+	tests := map[string]bool{
+		"/Photos/{yyyy}/{mm}":  true,
+		"{yy}-{mm}-{dd}":       true,
+		"/Photos":              false,
+		"/Photos/{yyyy}/{hh}":  false,
+		"/Photos/{YYYY}/{mm}":  true,
+		"/Photos/{yyyy}/{mm}/": true,
+	}
+	for layout, ok := range tests {
+		if err := checkLayout(layout); (err == nil) != ok {
+			t.Errorf("check layout %s want ok: %v, result: %v", layout, ok, err)
+		}
+	}
+}
+
+// 新建指定修改时间的文件
+func layoutFile(t *testing.T, dir, name string, mtime time.Time) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLayoutDir(t *testing.T) {
+	file := layoutFile(t, t.TempDir(), "a.jpg", time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local))
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"/Photos/{yyyy}/{mm}": "/Photos/2024/01",
+		"{yy}{mm}{dd}":        "240102",
+		"{yyyy}/{dd}/raw":     "2024/02/raw",
+	}
+	for layout, want := range tests {
+		if dir := layoutDir(layout, info); dir != want {
+			t.Errorf("layout dir of %s want: %s, result: %s", layout, want, dir)
+		}
+	}
+}
+
+func TestApplyDateLayout(t *testing.T) {
+	verbose = new(bool)
+	dryRun = new(bool)
+	*dryRun = true
+	defer func(r resultData, dc *dirCacheData, cid uint64, layout string) {
+		result, dirCache, config.CID, dateLayout = r, dc, cid, layout
+	}(result, dirCache, config.CID, dateLayout)
+	result = resultData{}
+	config.CID = 100
+	dirCache = newDirCache(filepath.Join(t.TempDir(), "dirs.json"))
+	dirCache.put(100, "2024", 200)
+	dirCache.put(200, "01", 300)
+
+	dir := t.TempDir()
+	jan := layoutFile(t, dir, "jan.jpg", time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local))
+	feb := layoutFile(t, dir, "feb.jpg", time.Date(2024, 2, 15, 0, 0, 0, 0, time.Local))
+	missing := filepath.Join(dir, "missing.jpg")
+
+	dateLayout = `{yyyy}\{mm}`
+	files := applyDateLayout([]fileInfo{{Path: jan}, {Path: missing}, {Path: feb}})
+	if len(files) != 2 {
+		t.Fatalf("laid out files want: 2, result: %d", len(files))
+	}
+	if len(result.Failed) != 1 || result.Failed[0] != missing {
+		t.Errorf("failed files want: [%s], result: %v", missing, result.Failed)
+	}
+
+	tests := []struct {
+		remoteDir string
+		parentID  uint64
+		pending   bool
+	}{
+		{"2024/01", 300, false},
+		{"2024/02", 0, true},
+	}
+	for i, tt := range tests {
+		f := files[i]
+		if f.RemoteDir != tt.remoteDir || f.ParentID != tt.parentID || f.dirPending != tt.pending {
+			t.Errorf("file %s want: %s %d %v, result: %s %d %v", f.Path, tt.remoteDir, tt.parentID, tt.pending,
+				f.RemoteDir, f.ParentID, f.dirPending)
+		}
+	}
+}
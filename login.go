@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// 扫码登录的超时时间
+const loginTimeout = 5 * time.Minute
+
+// 扫码登录时可以模拟的客户端，和网页端相同时会导致网页端退出登录
+var loginApps = []string{"web", "android", "ios", "linux", "mac", "windows", "tv", "alipaymini", "wechatmini", "qandroid"}
+
+var loginApp *string // 扫码登录时模拟的客户端
+
+// 二维码的状态
+const (
+	qrWaiting   = 0  // 等待扫码
+	qrScanned   = 1  // 已扫码，等待确认
+	qrConfirmed = 2  // 已确认登录
+	qrExpired   = -1 // 二维码已过期
+	qrCanceled  = -2 // 已取消登录
+)
+
+// 检查扫码登录模拟的客户端
+func checkLoginApp(app string) error {
+	for _, a := range loginApps {
+		if a == app {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的客户端 %s ，只支持 %s", app, strings.Join(loginApps, "、"))
+}
+
+// 判断图片的像素是否是深色
+func isDark(img image.Image, x, y int) bool {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return r+g+b < 3*0x8000
+}
+
+// 从二维码图片里读取二维码的模块，true 为深色模块
+func sampleQRCode(img image.Image) ([][]bool, error) {
+	bounds := img.Bounds()
+	minX, minY, maxX, maxY := bounds.Max.X, bounds.Max.Y, bounds.Min.X-1, bounds.Min.Y-1
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isDark(img, x, y) {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < minX {
+		return nil, errors.New("图片里没有二维码")
+	}
+
+	// 左上角的定位图案宽 7 个模块
+	run := 0
+	for x := minX; x <= maxX && isDark(img, x, minY); x++ {
+		run++
+	}
+	size := float64(run) / 7
+	if size < 1 {
+		return nil, errors.New("无法识别二维码的模块大小")
+	}
+	n := int(math.Round(float64(maxX-minX+1) / size))
+	if n < 21 || (n-17)%4 != 0 {
+		return nil, fmt.Errorf("二维码的模块数量 %d 不正确", n)
+	}
+
+	modules := make([][]bool, n)
+	for i := range modules {
+		modules[i] = make([]bool, n)
+		for j := range modules[i] {
+			x := minX + int((float64(j)+0.5)*size)
+			y := minY + int((float64(i)+0.5)*size)
+			modules[i][j] = isDark(img, x, y)
+		}
+	}
+	return modules, nil
+}
+
+// 用字符在终端显示二维码，每个字符显示上下两个模块，周围留出 2 个模块的空白
+func renderQRCode(modules [][]bool) string {
+	const quiet = 2
+	n := len(modules) + 2*quiet
+	light := func(i, j int) bool {
+		i, j = i-quiet, j-quiet
+		if i < 0 || j < 0 || i >= len(modules) || j >= len(modules) {
+			return true
+		}
+		return !modules[i][j]
+	}
+
+	var sb strings.Builder
+	for i := 0; i < n; i += 2 {
+		for j := 0; j < n; j++ {
+			top, bottom := light(i, j), i+1 >= n || light(i+1, j)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// 在终端显示二维码，无法显示时将二维码图片保存到文件
+func showQRCode(uid string) error {
+	data, err := getURL(fmt.Sprintf(qrImageURL, url.QueryEscape(uid)))
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err == nil {
+		var modules [][]bool
+		if modules, err = sampleQRCode(img); err == nil {
+			fmt.Print(renderQRCode(modules))
+			return nil
+		}
+	}
+
+	file := filepath.Join(os.TempDir(), "fake115uploader-qrcode.png")
+	if e := os.WriteFile(file, data, 0644); e != nil {
+		return fmt.Errorf("无法显示二维码：%v ，保存二维码图片出现错误：%w", err, e)
+	}
+	log.Printf("无法在终端显示二维码（%v），请打开图片 %s 扫码", err, file)
+	return nil
+}
+
+// 等待扫码确认登录
+func waitQRLogin(uid string, t int64, sign string) error {
+	deadline := time.Now().Add(loginTimeout)
+	scanned := false
+	for time.Now().Before(deadline) {
+		// 长轮询请求超时时重新请求
+		v, err := getURLJSON(fmt.Sprintf(qrStatusURL, url.QueryEscape(uid), t, url.QueryEscape(sign)))
+		if err != nil {
+			if *verbose {
+				log.Printf("获取二维码状态出现错误：%v", err)
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		if v.Get("data", "status") == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		switch status := v.GetInt("data", "status"); status {
+		case qrWaiting:
+		case qrScanned:
+			if !scanned {
+				log.Println("已扫码，请在手机上确认登录")
+				scanned = true
+			}
+		case qrConfirmed:
+			return nil
+		case qrExpired:
+			return errors.New("二维码已过期，请重新登录")
+		case qrCanceled:
+			return errors.New("已取消登录")
+		default:
+			return fmt.Errorf("未知的二维码状态 %d", status)
+		}
+		time.Sleep(time.Second)
+	}
+	return errors.New("等待扫码超时，请重新登录")
+}
+
+// 从登录结果里生成 Cookie
+func loginCookies(v *fastjson.Value) (string, error) {
+	obj := v.GetObject("data", "cookie")
+	if obj == nil {
+		return "", fmt.Errorf("登录失败：%s", v.GetStringBytes("message"))
+	}
+	var cookies []string
+	obj.Visit(func(key []byte, v *fastjson.Value) {
+		if value := v.GetStringBytes(); len(value) != 0 {
+			cookies = append(cookies, fmt.Sprintf("%s=%s", key, value))
+		}
+	})
+	if len(cookies) == 0 {
+		return "", errors.New("登录失败：没有返回 Cookie")
+	}
+	return strings.Join(cookies, "; "), nil
+}
+
+// 将 Cookie 保存到设置文件，只改动 cookies 的值，保留设置文件里的其他内容（包括不认识的设置）
+func saveCookies(file, cookies string) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		// 设置文件不存在时新建设置文件
+		data, err = json.MarshalIndent(uploadConfig{Cookies: cookies}, "", "    ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(file, data, 0644)
+	} else if err != nil {
+		return err
+	}
+
+	var c map[string]json.RawMessage
+	if err = json.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("设置文件 %s 的内容不符合json格式：%w", file, err)
+	}
+	if c == nil {
+		c = make(map[string]json.RawMessage)
+	}
+	value, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+	c["cookies"] = value
+	// Cookie 文件优先于 cookies，清空 cookieFile 才会使用扫码登录的 Cookie
+	var cookieFile string
+	if json.Unmarshal(c["cookieFile"], &cookieFile) == nil && cookieFile != "" {
+		log.Printf("清空设置文件 %s 里的cookieFile（%s），之后使用扫码登录的Cookie", file, cookieFile)
+		c["cookieFile"] = json.RawMessage(`""`)
+	}
+	data, err = json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// login 子命令，扫码登录 115 并将 Cookie 保存到设置文件
+func loginCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New("用法：login")
+	}
+	if err := checkLoginApp(*loginApp); err != nil {
+		return err
+	}
+
+	v, err := getURLJSON(qrTokenURL)
+	if err != nil {
+		return err
+	}
+	if !v.GetBool("state") {
+		return fmt.Errorf("获取二维码失败：%s", v.GetStringBytes("message"))
+	}
+	uid := string(v.GetStringBytes("data", "uid"))
+	t := v.GetInt64("data", "time")
+	sign := string(v.GetStringBytes("data", "sign"))
+	if uid == "" {
+		return errors.New("获取二维码失败：没有返回 uid")
+	}
+
+	log.Printf("请用 115 手机客户端扫描二维码登录，模拟的客户端是 %s", *loginApp)
+	if err := showQRCode(uid); err != nil {
+		return err
+	}
+	if err := waitQRLogin(uid, t, sign); err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("account", uid)
+	form.Set("app", *loginApp)
+	v, err = postFormJSON(fmt.Sprintf(qrLoginURL, *loginApp), form.Encode())
+	if err != nil {
+		return err
+	}
+	cookies, err := loginCookies(v)
+	if err != nil {
+		return err
+	}
+	if err := saveCookies(*configFile, cookies); err != nil {
+		return err
+	}
+	config.Cookies = cookies
+	log.Printf("登录成功，Cookie 已经保存到设置文件 %s", *configFile)
+
+	if err := getUserKey(); err != nil {
+		return err
+	}
+	log.Printf("用户 id：%s", userID)
+	return nil
+}
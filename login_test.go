@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fastjson"
+)
+
+func TestSampleQRCode(t *testing.T) {
+	const n, scale, margin = 25, 4, 8
+	modules := make([][]bool, n)
+	r := rand.New(rand.NewSource(1))
+	for i := range modules {
+		modules[i] = make([]bool, n)
+		for j := range modules[i] {
+			modules[i][j] = r.Intn(2) == 0
+		}
+	}
+	// 定位图案和周围的分隔符
+	for _, p := range [][2]int{{0, 0}, {0, n - 8}, {n - 8, 0}} {
+		for i := 0; i < 8; i++ {
+			for j := 0; j < 8; j++ {
+				// 分隔符在定位图案靠近二维码中间的一侧
+				fi, fj := i, j
+				if p[0] != 0 {
+					fi = i - 1
+				}
+				if p[1] != 0 {
+					fj = j - 1
+				}
+				if fi < 0 || fj < 0 || fi > 6 || fj > 6 {
+					modules[p[0]+i][p[1]+j] = false
+					continue
+				}
+				ring := fi == 0 || fi == 6 || fj == 0 || fj == 6
+				inner := fi >= 2 && fi <= 4 && fj >= 2 && fj <= 4
+				modules[p[0]+i][p[1]+j] = ring || inner
+			}
+		}
+	}
+
+	size := n*scale + 2*margin
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetGray(x, y, color.Gray{Y: 0xff})
+		}
+	}
+	for i := range modules {
+		for j := range modules[i] {
+			if !modules[i][j] {
+				continue
+			}
+			for y := 0; y < scale; y++ {
+				for x := 0; x < scale; x++ {
+					img.SetGray(margin+j*scale+x, margin+i*scale+y, color.Gray{})
+				}
+			}
+		}
+	}
+
+	result, err := sampleQRCode(img)
+	if err != nil {
+		t.Fatalf("sampleQRCode() error: %v", err)
+	}
+	if len(result) != n {
+		t.Fatalf("modules count want: %d, result: %d", n, len(result))
+	}
+	for i := range modules {
+		for j := range modules[i] {
+			if result[i][j] != modules[i][j] {
+				t.Fatalf("module (%d, %d) want: %v, result: %v", i, j, modules[i][j], result[i][j])
+			}
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(renderQRCode(result), "\n"), "\n")
+	if len(lines) != (n+4+1)/2 {
+		t.Errorf("rendered lines want: %d, result: %d", (n+4+1)/2, len(lines))
+	}
+}
+
+func TestLoginCookies(t *testing.T) {
+	v := fastjson.MustParse(`{"state":1,"data":{"cookie":{"UID":"1_A1_2","CID":"abc","SEID":"def","KID":""}}}`)
+	cookies, err := loginCookies(v)
+	if err != nil {
+		t.Fatalf("loginCookies() error: %v", err)
+	}
+	if want := "UID=1_A1_2; CID=abc; SEID=def"; cookies != want {
+		t.Errorf("cookies want: %s, result: %s", want, cookies)
+	}
+
+	if _, err := loginCookies(fastjson.MustParse(`{"state":0,"message":"error"}`)); err == nil {
+		t.Error("loginCookies() should fail without cookie")
+	}
+	if err := checkLoginApp("tv"); err != nil {
+		t.Errorf("checkLoginApp(tv) error: %v", err)
+	}
+	if err := checkLoginApp("unknown"); err == nil {
+		t.Error("checkLoginApp(unknown) should fail")
+	}
+}
+
+func TestSaveCookies(t *testing.T) {
+	dir := t.TempDir()
+
+	// 设置文件不存在时新建
+	file := filepath.Join(dir, "new.json")
+	if err := saveCookies(file, "UID=1"); err != nil {
+		t.Fatal(err)
+	}
+	var c uploadConfig
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.Cookies != "UID=1" {
+		t.Errorf("cookies in new config want: UID=1, result: %q %v", c.Cookies, err)
+	}
+
+	// 只改动 cookies，保留其他设置和不认识的设置
+	file = filepath.Join(dir, "old.json")
+	old := `{"cookies":"UID=0","cid":123,"cookieFile":"cookies.txt","future":{"a":[1,2]}}`
+	if err := os.WriteFile(file, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCookies(file, "UID=2"); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result, want map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	_ = json.Unmarshal([]byte(`{"cookies":"UID=2","cid":123,"cookieFile":"","future":{"a":[1,2]}}`), &want)
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("saved config want: %v, result: %v", want, result)
+	}
+
+	if err := os.WriteFile(file, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveCookies(file, "UID=3"); err == nil {
+		t.Error("saveCookies() should fail with invalid config")
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
 	"log"
 	"net"
 	"net/http"
@@ -17,6 +16,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -31,36 +31,67 @@ import (
 // sampleInitURL = "https://uplb.115.com/3.0/sampleinitupload.php"
 
 const (
-	infoURL        = "https://proapi.115.com/app/uploadinfo"
-	initURL        = "https://uplb.115.com/4.0/initupload.php?k_ec=%s"
-	getinfoURL     = "https://uplb.115.com/3.0/getuploadinfo.php"
-	listFileURL    = "https://webapi.115.com/files?aid=1&cid=%d&o=user_ptime&asc=0&offset=0&show_dir=0&limit=%d&natsort=1&format=json"
-	listFileDirURL = "https://webapi.115.com/files?aid=1&cid=%d&o=user_ptime&asc=0&offset=0&show_dir=1&limit=100000&natsort=1&format=json"
-	downloadURL    = "https://proapi.115.com/app/chrome/downurl"
-	orderURL       = "https://webapi.115.com/files/order"
-	createDirURL   = "https://webapi.115.com/files/add"
-	searchURL      = "https://webapi.115.com/files/search?offset=0&limit=100000&aid=1&cid=%d&format=json"
-	appVer         = "30.5.1"
-	userAgent      = "Mozilla/5.0 115disk/" + appVer
-	endString      = "000000"
-	aliUserAgent   = "aliyun-sdk-android/2.9.1"
-	linkPrefix     = "115://"
-	targetPrefix   = "U_1_"
-	maxParts       = 10000
+	infoURL              = "https://proapi.115.com/app/uploadinfo"
+	initURL              = "https://uplb.115.com/4.0/initupload.php?k_ec=%s"
+	getinfoURL           = "https://uplb.115.com/3.0/getuploadinfo.php"
+	listFileURL          = "https://webapi.115.com/files?aid=1&cid=%d&o=user_ptime&asc=0&offset=0&show_dir=0&limit=%d&natsort=1&format=json"
+	listFileDirURL       = "https://webapi.115.com/files?aid=1&cid=%d&o=user_ptime&asc=0&offset=0&show_dir=1&limit=100000&natsort=1&format=json"
+	downloadURL          = "https://proapi.115.com/app/chrome/downurl"
+	orderURL             = "https://webapi.115.com/files/order"
+	createDirURL         = "https://webapi.115.com/files/add"
+	searchURL            = "https://webapi.115.com/files/search?offset=0&limit=100000&aid=1&cid=%d&format=json"
+	deleteURL            = "https://webapi.115.com/rb/delete"
+	moveURL              = "https://webapi.115.com/files/move"
+	copyURL              = "https://webapi.115.com/files/copy"
+	renameURL            = "https://webapi.115.com/files/batch_rename"
+	shareSendURL         = "https://webapi.115.com/share/send"
+	shareUpdateURL       = "https://webapi.115.com/share/updateshare"
+	userInfoURL          = "https://my.115.com/?ct=ajax&ac=nav"
+	spaceInfoURL         = "https://webapi.115.com/files/index_info"
+	qrTokenURL           = "https://qrcodeapi.115.com/api/1.0/web/1.0/token/"
+	qrImageURL           = "https://qrcodeapi.115.com/api/1.0/web/1.0/qrcode?uid=%s"
+	qrStatusURL          = "https://qrcodeapi.115.com/get/status/?uid=%s&time=%d&sign=%s"
+	qrLoginURL           = "https://passportapi.115.com/app/1.0/%s/1.0/login/qrcode/"
+	appVer               = "30.5.1"
+	userAgent            = "Mozilla/5.0 115disk/" + appVer
+	endString            = "000000"
+	aliUserAgent         = "aliyun-sdk-android/2.9.1"
+	linkPrefix           = "115://"
+	targetPrefix         = "U_1_"
+	maxParts             = 10000
+	maxFileSize          = 115 * 1024 * 1024 * 1024 // 上传文件的最大大小
+	maxPutSize           = 5 * 1024 * 1024 * 1024   // 普通模式上传文件的最大大小
+	defaultMultipartSize = 100                      // 默认的改用断点续传模式上传的文件大小（MB）
+	defaultHashLookahead = 2                        // 默认的预先计算 hash 值的文件数量
+	defaultBandwidth     = "10M"                    // 默认的估算上传时间用的上传速度
 )
 
 var (
 	fastUpload      *bool
 	upload          *bool
 	multipartUpload *bool
+	autoUpload      *bool
+	checkHash       *bool
 	configFile      *string
 	saveDir         *string
 	internal        *bool
 	removeFile      *bool
+	incremental     *bool
+	snapshot        *bool
+	doneDir         *string
+	removeLog       *string
 	recursive       *bool
+	followSymlinks  *bool
+	emptyDirs       *bool
+	dryRun          *bool
+	planFile        *string
+	applyFile       *string
+	manifestFile    *string
+	bandwidth       int64 // 估算上传时间用的上传速度（字节每秒）
 	verbose         *bool
 	userID          string
 	userKey         string
+	sizeLimit       int64        // 账号允许上传的文件的最大大小
 	config          uploadConfig // 设置数据
 	result          resultData   // 上传结果
 	uploadingPart   bool
@@ -76,26 +107,50 @@ var (
 
 // 设置数据
 type uploadConfig struct {
-	Cookies   string `json:"cookies"`   // 115 网页版的 Cookie
-	CID       uint64 `json:"cid"`       // 115 里文件夹的 cid
-	ResultDir string `json:"resultDir"` // 在指定文件夹保存上传结果
-	HTTPRetry uint   `json:"httpRetry"` // HTTP 请求失败后的重试次数
-	HTTPProxy string `json:"httpProxy"` // HTTP 代理
-	OSSProxy  string `json:"ossProxy"`  // OSS 上传代理
-	PartsNum  uint   `json:"partsNum"`  // 断点续传的分片数量
+	Cookies       string `json:"cookies"`       // 115 网页版的 Cookie
+	CID           uint64 `json:"cid"`           // 115 里文件夹的 cid
+	ResultDir     string `json:"resultDir"`     // 在指定文件夹保存上传结果
+	HTTPRetry     uint   `json:"httpRetry"`     // HTTP 请求失败后的重试次数
+	HTTPProxy     string `json:"httpProxy"`     // HTTP 代理
+	OSSProxy      string `json:"ossProxy"`      // OSS 上传代理
+	PartsNum      uint   `json:"partsNum"`      // 断点续传的分片数量
+	MultipartSize uint64 `json:"multipartSize"` // 普通模式和自动模式下大于该大小（MB）的文件改用断点续传模式上传
+	HashCache     string `json:"hashCache"`     // hash 缓存文件
+	HashWorkers   uint   `json:"hashWorkers"`   // 同时计算 hash 值的文件数量
+	HashLookahead uint   `json:"hashLookahead"` // 预先计算 hash 值的文件数量，为 0 时不预先计算
+	DirCache      string `json:"dirCache"`      // 115 文件夹缓存文件
+	StateFile     string `json:"stateFile"`     // 上传状态文件
+	Bandwidth     string `json:"bandwidth"`     // 估算上传时间用的上传速度
+	CookieFile    string `json:"cookieFile"`    // 浏览器导出的 Cookie 文件
 }
 
 // 上传结果数据
 type resultData struct {
-	Success []string `json:"success"` // 上传成功的文件
-	Failed  []string `json:"failed"`  // 上传失败的文件
-	Saved   []string `json:"saved"`   // 保存上传进度的文件
+	Success []string      `json:"success"`          // 上传成功的文件
+	Failed  []string      `json:"failed"`           // 上传失败的文件
+	Saved   []string      `json:"saved"`            // 保存上传进度的文件
+	Skipped []string      `json:"skipped"`          // 跳过的文件及原因
+	Rows    []rowResult   `json:"rows,omitempty"`   // 清单里每一行的上传结果
+	Shares  []shareResult `json:"shares,omitempty"` // 上传的文件和文件夹的分享链接
 }
 
 // 要上传的文件的信息
 type fileInfo struct {
-	Path     string `json:"path"`     // 文件路径
-	ParentID uint64 `json:"parentID"` // 要上传到的文件夹的 cid
+	Path       string          `json:"path"`                // 文件路径
+	ParentID   uint64          `json:"parentID"`            // 要上传到的文件夹的 cid
+	Mode       string          `json:"mode,omitempty"`      // 上传模式，为空时使用参数指定的上传模式
+	RemoteDir  string          `json:"remoteDir,omitempty"` // 要上传到的文件夹相对 cid 指定的文件夹的路径，以 / 开头时从根目录开始
+	Name       string          `json:"name,omitempty"`      // 上传后的文件名，为空时使用原文件名
+	Row        int             `json:"row,omitempty"`       // 文件在清单里的行号，不是来自清单时为 0
+	Rel        string          `json:"rel,omitempty"`       // 递归上传文件夹时文件相对上传的文件夹的上级文件夹的路径
+	hashed     chan hashResult // 预先计算的 hash 值，为 nil 时在上传时计算
+	hashCancel chan struct{}   // 关闭时取消预先计算 hash 值
+	hashRead   *atomic.Int64   // 预先计算 hash 值时已经读取的数据大小
+	dirPending bool            // 演习时要上传到的文件夹还没在 115 创建
+	sha1       string          // 秒传时计算的文件的 sha1 值
+	name       string          // 秒传时上传的文件名
+	start      int64           // 开始上传的时间（秒）
+	remote     *remoteFile     // 上传后在 115 找到的文件
 }
 
 // 检查错误
@@ -111,6 +166,20 @@ func getTime() string {
 	return fmt.Sprintf("%d-%02d-%02d %02d-%02d-%02d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
 }
 
+// 格式化文件大小
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
 // 处理输入
 func getInput(ctx context.Context) {
 	defer func() {
@@ -179,6 +248,9 @@ func handleQuit() {
 	}
 
 	closeKeybord()
+	hashCache.save()
+	dirCache.save()
+	uploadState.save()
 	exitPrint()
 	if len(result.Failed) != 0 {
 		os.Exit(1)
@@ -197,7 +269,7 @@ func exitPrint() {
 		}
 	}()
 
-	if len(result.Success) == 0 && len(result.Failed) == 0 && len(result.Saved) == 0 {
+	if len(result.Success) == 0 && len(result.Failed) == 0 && len(result.Saved) == 0 && len(result.Skipped) == 0 && len(result.Rows) == 0 && len(result.Shares) == 0 {
 		log.Println("本次运行没有上传文件")
 		return
 	}
@@ -223,6 +295,35 @@ func exitPrint() {
 	for _, s := range result.Saved {
 		fmt.Println(s)
 	}
+	if len(result.Skipped) != 0 {
+		fmt.Printf("跳过的文件（%d）：\n", len(result.Skipped))
+		for _, s := range result.Skipped {
+			fmt.Println(s)
+		}
+	}
+	if len(result.Rows) != 0 {
+		fmt.Printf("清单的上传结果（%d）：\n", len(result.Rows))
+		for _, r := range result.Rows {
+			if r.Error != "" {
+				fmt.Printf("第 %d 行 %s %s：%s\n", r.Row, r.Path, r.Status, r.Error)
+			} else {
+				fmt.Printf("第 %d 行 %s %s\n", r.Row, r.Path, r.Status)
+			}
+		}
+	}
+	if len(result.Shares) != 0 {
+		fmt.Printf("分享链接（%d）：\n", len(result.Shares))
+		for _, sr := range result.Shares {
+			if sr.Row != 0 {
+				fmt.Printf("第 %d 行 ", sr.Row)
+			}
+			if sr.Error != "" {
+				fmt.Printf("%s 分享失败：%s\n", sr.Path, sr.Error)
+			} else {
+				fmt.Printf("%s %s 访问码：%s\n", sr.Path, sr.URL, sr.Code)
+			}
+		}
+	}
 }
 
 // 进行 http 请求
@@ -243,7 +344,7 @@ func doRequest(req *http.Request) (resp *http.Response, err error) {
 func getUserKey() (e error) {
 	defer func() {
 		if err := recover(); err != nil {
-			log.Println("请确定网络是否畅通或者 cookies 是否设置好，每一次登陆网页端 115 都要重设一次 cookies")
+			log.Println("请确定网络是否畅通或者 cookies 是否设置好，cookies 失效时需要重新设置或者运行 fake115uploader login 扫码登录")
 			e = fmt.Errorf("getUserKey() error: %v", err)
 		}
 	}()
@@ -263,6 +364,8 @@ func getUserKey() (e error) {
 	checkErr(err)
 	userID = strconv.Itoa(v.GetInt("user_id"))
 	userKey = string(v.GetStringBytes("userkey"))
+	// 非 vip 账号的上传大小限制比 vip 账号的小
+	sizeLimit = v.GetInt64("size_limit")
 
 	if userID == "0" {
 		panic(fmt.Errorf("获取 userkey 出错，请确定 cookies 是否设置好"))
@@ -270,6 +373,7 @@ func getUserKey() (e error) {
 
 	if *verbose {
 		log.Printf("userID和userKey的值分别是：%s %s", userID, userKey)
+		log.Printf("上传文件的大小限制是：%d", sizeLimit)
 	}
 	return nil
 }
@@ -353,6 +457,8 @@ func createDir(pid uint64, name string) (cid uint64, e error) {
 		if err == nil {
 			return cid, nil
 		}
+	} else if exists, err := dirExists(pid); err == nil && !exists {
+		return 0, fmt.Errorf("创建文件夹 %s 失败，上级文件夹 %d ：%w", name, pid, errDirNotFound)
 	}
 
 	return 0, fmt.Errorf("创建文件夹 %s 失败", name)
@@ -379,11 +485,15 @@ func loadConfig() (e error) {
 	}()
 
 	if _, err := os.Stat(*configFile); os.IsNotExist(err) {
-		log.Printf("设置文件不存在，新建设置文件 %s ，请先设置cookies", *configFile)
 		data, err := json.MarshalIndent(config, "", "    ")
 		checkErr(err)
 		err = os.WriteFile(*configFile, data, 0644)
 		checkErr(err)
+		if commands[cmdName].noCookies {
+			log.Printf("设置文件不存在，新建设置文件 %s", *configFile)
+			return nil
+		}
+		log.Printf("设置文件不存在，新建设置文件 %s ，请先设置cookies或者运行 fake115uploader login 扫码登录", *configFile)
 		os.Exit(1)
 	} else {
 		data, err := os.ReadFile(*configFile)
@@ -408,25 +518,70 @@ func initialize() (e error) {
 	}()
 
 	fastUpload = flag.Bool("f", false, "秒传模式上传`文件`")
-	upload = flag.Bool("u", false, "先尝试用秒传模式上传`文件`，失败后改用普通模式上传")
+	upload = flag.Bool("u", false, "先尝试用秒传模式上传`文件`，失败后改用普通模式上传，较大的文件会改用断点续传模式上传")
 	multipartUpload = flag.Bool("m", false, "先尝试用秒传模式上传`文件`，失败后改用断点续传模式上传，可以随时中断上传再重启上传（适合用于上传超大文件，注意暂停上传的时间不要太长）")
+	autoUpload = flag.Bool("auto", false, "自动选择上传模式：先尝试秒传，失败后按文件大小选择普通模式或者断点续传模式，和 -u 相同")
 	configFile = flag.String("l", "", "指定设置`文件`（json 格式），默认是程序所在的文件夹里的 fake115uploader.json")
 	saveDir = flag.String("d", "", "指定存放断点续传存档文件的`文件夹`，默认是程序所在的文件夹")
 	cookies := flag.String("k", "", "使用指定的 115 的`Cookie`")
+	cookieFile := flag.String("cookie-file", "", "从浏览器导出的 Cookie `文件`（Netscape 格式的 cookies.txt 或者 Cookie 扩展导出的 json 文件）读取 115 的 Cookie")
 	cid := flag.Uint64("c", 1, "上传文件到指定的 115 文件夹，`cid`为 115 里的文件夹对应的 cid(默认为 0，即根目录）")
 	resultDir := flag.String("r", "", "将上传结果保存在指定`文件夹`")
 	noConfig := flag.Bool("n", false, "不读取设置文件，需要和 -k 配合使用")
 	internal = flag.Bool("a", false, "利用阿里云内网上传文件，需要在阿里云服务器上运行本程序")
-	removeFile = flag.Bool("e", false, "上传成功后自动删除原文件")
+	removeFile = flag.Bool("e", false, "上传成功并在 115 确认这次上传的文件的文件名、sha1 和大小后自动删除原文件")
+	doneDir = flag.String("done-dir", "", "上传成功并在 115 确认这次上传的文件的文件名、sha1 和大小后将原文件移动到指定`文件夹`（保留文件夹结构），而不是删除原文件")
+	removeLog = flag.String("remove-log", "", "记录删除和移动的原文件的`文件`，默认是 -d 指定的文件夹里的 removed.log")
+	checkHash = flag.Bool("check-hash", false, "计算文件的 hash 值时同时计算文件的 crc64 值和每个分片的 md5 值，上传时校验数据的完整性")
 	httpProxy := flag.String("http-proxy", "", "指定 HTTP`代理`")
 	ossProxy := flag.String("oss-proxy", "", "指定 OSS 上传使用的`代理`")
 	httpRetry := flag.Uint("http-retry", 0, "HTTP 请求失败后的`重试次数`，默认为 0（即不重试）")
 	recursive = flag.Bool("recursive", false, "递归上传文件夹")
+	flag.Var(&filterOpts.include, "include", "递归上传文件夹时只上传匹配`模式`的文件，支持 ** 通配符，没有 / 的模式匹配文件名，可以多次指定")
+	flag.Var(&filterOpts.exclude, "exclude", "递归上传文件夹时不上传匹配`模式`的文件和文件夹，支持 ** 通配符，没有 / 的模式匹配文件名，可以多次指定")
+	minSize := flag.String("min-size", "", "递归上传文件夹时不上传小于该`大小`的文件，支持 K、M、G、T 单位")
+	maxSize := flag.String("max-size", "", "递归上传文件夹时不上传大于该`大小`的文件，支持 K、M、G、T 单位")
+	modifiedSince := flag.String("modified-since", "", "递归上传文件夹时只上传在该`时间`之后修改过的文件，格式为 2006-01-02、2006-01-02 15:04:05 或者相对现在的时长（例如 24h）")
+	followSymlinks = flag.Bool("follow-symlinks", false, "递归上传文件夹时跟随符号链接，默认跳过符号链接")
+	emptyDirs = flag.Bool("empty-dirs", false, "递归上传文件夹时在 115 创建空文件夹，默认只创建有文件要上传的文件夹")
+	flag.BoolVar(&filterOpts.skipHidden, "skip-hidden", false, "递归上传文件夹时不上传隐藏文件和隐藏文件夹")
+	dirCacheFile := flag.String("dir-cache", "", "使用指定的文件夹缓存`文件`，缓存已创建的 115 文件夹的 cid，减少创建文件夹的请求")
+	stateFile := flag.String("state", "", "使用指定的上传状态`文件`，记录上传过的文件和每次运行的上传结果")
+	incremental = flag.Bool("incremental", false, "增量上传，不上传上传状态里记录的大小和修改时间都没有改变的文件，需要设置上传状态文件")
+	snapshot = flag.Bool("snapshot", false, "快照模式，每次运行都上传到 -c 指定的文件夹里以当前时间命名的新文件夹，没有改变的文件会秒传")
+	flag.IntVar(&keep.last, "keep-last", 0, "快照模式上传完成后保留最近的`数量`个快照，删除不符合保留规则的旧快照，所有保留规则都为 0 时不删除")
+	flag.IntVar(&keep.daily, "keep-daily", 0, "快照模式上传完成后保留包括今天在内最近`天数`天里每天最新的快照，没有快照的日子也算在天数里")
+	flag.IntVar(&keep.monthly, "keep-monthly", 0, "快照模式上传完成后保留包括本月在内最近`月数`个月里每月最新的快照，没有快照的月份也算在月数里")
+	hashCacheFile := flag.String("hash-cache", "", "使用指定的 hash 缓存`文件`，缓存文件的 hash 值，文件没有改变时不用重新计算")
+	hashWorkers := flag.Uint("hash-workers", 0, "同时计算 hash 值的`文件数量`，默认为 1")
+	hashLookahead := flag.Uint("hash-lookahead", 0, "上传文件时预先计算之后的文件的 hash 值的`文件数量`，默认为 2")
+	noLookahead := flag.Bool("no-hash-lookahead", false, "不预先计算之后的文件的 hash 值")
 	partsNum := flag.Uint("parts-num", 0, "断点续传模式上传文件的`分片数量`，范围为 1 到 10000，默认为 0（即自动分片）")
+	multipartSize := flag.Uint64("multipart-size", 0, "普通模式和自动模式下大于该`大小`（MB）的文件改用断点续传模式上传，默认为 100")
+	dryRun = flag.Bool("dry-run", false, "演习模式，只打印上传计划，不上传文件也不创建文件夹")
+	planFile = flag.String("plan", "", "将上传计划保存在指定`文件`里，不上传文件，之后可以用 -apply 执行")
+	manifestFile = flag.String("manifest", "", "上传清单`文件`里的文件，每一行是 json 对象或者 CSV 格式的“本地文件路径,115 文件夹的 cid 或路径,文件名,上传模式”")
+	applyFile = flag.String("apply", "", "执行指定`文件`里保存的上传计划")
+	bandwidthFlag := flag.String("bandwidth", "", "演习模式估算上传时间用的上传`速度`（每秒），支持 K、M、G 单位，默认为 10M")
+	flag.StringVar(&dateLayout, "date-layout", "", "按文件的修改时间将文件上传到`路径模板`对应的 115 文件夹，支持 {yyyy}、{yy}、{mm} 和 {dd} 变量，例如 /Photos/{yyyy}/{mm}，以 / 开头的路径从根目录开始，否则从 -c 指定的文件夹开始")
+	flag.StringVar(&renameOpts.template, "name-template", "", "上传后的文件名的`模板`，支持 {name}、{base}、{ext}、{date}、{time}、{now} 和 {size} 变量，例如 {date}_{name}")
+	flag.StringVar(&renameOpts.prefix, "name-prefix", "", "在上传后的文件名前面加上`前缀`")
+	flag.StringVar(&renameOpts.suffix, "name-suffix", "", "在上传后的文件名的扩展名前面加上`后缀`")
+	jsonOutput = flag.Bool("json", false, "子命令以 json 格式输出结果")
+	dupesKeep = flag.String("dupes-keep", keepOldest, "dupes 子命令保留重复文件的`规则`，oldest 保留最早上传的文件，shortest 保留路径最短的文件")
+	dupesDelete = flag.Bool("dupes-delete", false, "dupes 子命令删除多余的重复文件，需要和 -confirm 配合使用")
+	dupesMove = flag.String("dupes-move", "", "dupes 子命令将多余的重复文件移动到指定的 115 `文件夹`（路径或者 id:cid），需要和 -confirm 配合使用")
+	cleanupAll = flag.Bool("cleanup-all", false, "cleanup 子命令不指定存档文件时也取消还可以继续的上传，默认只清理原文件已经不存在或者上传已经失效的存档文件")
+	loginApp = flag.String("login-app", "alipaymini", "login 子命令扫码登录时模拟的`客户端`，支持 web、android、ios、linux、mac、windows、tv、alipaymini、wechatmini 和 qandroid，和网页端相同时会导致网页端退出登录")
+	noQuotaEstimate = flag.Bool("no-quota-estimate", false, "上传前不按最坏情况（所有文件都不能秒传）估算需要上传的大小是否超过 115 的剩余空间")
+	shareUpload = flag.Bool("share", false, "上传完成后分享上传的文件和递归上传时创建的顶层文件夹，分享链接和访问码记录在上传结果里")
+	flag.IntVar(&shareOpts.days, "share-days", 7, "分享的有效`天数`，-1 为永久有效")
+	flag.StringVar(&shareOpts.code, "share-code", "", "分享的访问`码`，必须是 4 位数字或字母，默认由 115 随机生成")
+	confirm = flag.Bool("confirm", false, "确认执行 dupes 子命令的删除或移动操作，默认只打印结果")
 	verbose = flag.Bool("v", false, "显示更详细的信息（调试用）")
 	help := flag.Bool("h", false, "显示帮助信息")
 
-	flag.Parse()
+	parseArgs()
 
 	if *configFile == "" {
 		path, err := os.Executable()
@@ -445,22 +600,86 @@ func initialize() (e error) {
 		checkErr(err)
 	}
 
-	if flag.NFlag() == 0 {
+	if flag.NFlag() == 0 && cmdName == "" {
 		log.Println("请输入正确的参数")
-		flag.PrintDefaults()
+		printUsage()
 		os.Exit(1)
 	}
 	if *help {
-		flag.PrintDefaults()
+		printUsage()
 		os.Exit(0)
 	}
-	if (*fastUpload && *upload) || (*fastUpload && *multipartUpload) || (*upload && *multipartUpload) {
-		log.Println("-f、-u 和-m 这三个参数只能同时使用其中一个")
+	modes := 0
+	for _, mode := range []bool{*fastUpload, *upload, *multipartUpload, *autoUpload} {
+		if mode {
+			modes++
+		}
+	}
+	if modes > 1 {
+		log.Println("-f、-u、-m 和 -auto 这四个参数只能同时使用其中一个")
+		os.Exit(1)
+	}
+
+	if *planFile != "" {
+		*dryRun = true
+	}
+	if *dryRun && *applyFile != "" {
+		log.Println("-apply 参数不能和 -dry-run 或 -plan 参数同时使用")
+		os.Exit(1)
+	}
+	if *dryRun && modes == 0 && *manifestFile == "" {
+		log.Println("演习模式需要用 -f、-u、-m 或 -auto 参数指定上传模式")
+		os.Exit(1)
+	}
+	if *applyFile != "" && (modes != 0 || len(flag.Args()) != 0 || *manifestFile != "") {
+		log.Println("执行上传计划时使用计划里的文件和上传模式，不能再指定上传模式和文件")
+		os.Exit(1)
+	}
+
+	if dateLayout != "" {
+		if err := checkLayout(dateLayout); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	}
+	if err := checkTemplate(renameOpts.template); err != nil {
+		log.Println(err)
 		os.Exit(1)
 	}
+	if strings.ContainsAny(renameOpts.prefix+renameOpts.suffix, `/\`) {
+		log.Println("文件名前缀和后缀不能包含 / 或 \\")
+		os.Exit(1)
+	}
+
+	if *snapshot && (*incremental || *planFile != "" || *applyFile != "") {
+		log.Println("-snapshot 参数不能和 -incremental、-plan 或 -apply 参数同时使用")
+		os.Exit(1)
+	}
+	if err := shareOpts.check(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+
+	if keep.last < 0 || keep.daily < 0 || keep.monthly < 0 {
+		log.Println("快照的保留数量不能小于 0")
+		os.Exit(1)
+	}
+
+	// 优先使用参数指定的上传速度
+	if *bandwidthFlag != "" {
+		config.Bandwidth = *bandwidthFlag
+	}
+	if config.Bandwidth == "" {
+		config.Bandwidth = defaultBandwidth
+	}
+	if *dryRun {
+		var err error
+		bandwidth, err = parseSize(config.Bandwidth)
+		checkErr(err)
+	}
 
-	if *partsNum != 0 && !*multipartUpload {
-		log.Println("-parts-num 参数只支持断点续传模式")
+	if *partsNum != 0 && *fastUpload {
+		log.Println("-parts-num 参数不支持秒传模式")
 		os.Exit(1)
 	}
 	// 优先使用参数指定的分片数量
@@ -472,12 +691,50 @@ func initialize() (e error) {
 		os.Exit(1)
 	}
 
+	// 优先使用参数指定的大小
+	if *multipartSize != 0 {
+		config.MultipartSize = *multipartSize
+	}
+	if config.MultipartSize == 0 {
+		config.MultipartSize = defaultMultipartSize
+	}
+
+	if *minSize != "" {
+		size, err := parseSize(*minSize)
+		checkErr(err)
+		filterOpts.minSize = size
+	}
+	if *maxSize != "" {
+		size, err := parseSize(*maxSize)
+		checkErr(err)
+		filterOpts.maxSize = size
+	}
+	if *modifiedSince != "" {
+		t, err := parseTime(*modifiedSince)
+		checkErr(err)
+		filterOpts.modifiedSince = t
+	}
+
+	// 优先使用参数指定的 Cookie 文件，-k 指定 Cookie 或者子命令不需要 Cookie 时不读取，
+	// Cookie 文件优先于设置文件里的 cookies
+	if *cookieFile != "" {
+		config.CookieFile = *cookieFile
+	}
+	if config.CookieFile != "" && *cookies == "" && !commands[cmdName].noCookies {
+		c, err := loadCookieFile(config.CookieFile)
+		checkErr(err)
+		if config.Cookies != "" {
+			log.Printf("使用 Cookie 文件 %s 里的Cookie，忽略设置文件里的cookies", config.CookieFile)
+		}
+		config.Cookies = c
+	}
+
 	// 优先使用参数指定的 Cookie
 	if *cookies != "" {
 		config.Cookies = *cookies
 	}
-	if config.Cookies == "" {
-		log.Printf("设置文件 %s 里的cookies不能为空字符串，或者用-k指定115的Cookie", *configFile)
+	if config.Cookies == "" && !commands[cmdName].noCookies {
+		log.Printf("设置文件 %s 里的cookies不能为空字符串，或者用-k指定115的Cookie，也可以运行 fake115uploader login 扫码登录", *configFile)
 		os.Exit(1)
 	}
 	if *verbose {
@@ -502,6 +759,56 @@ func initialize() (e error) {
 		}
 	}
 
+	// 优先使用参数指定的 hash 缓存文件
+	if *hashCacheFile != "" {
+		config.HashCache = *hashCacheFile
+	}
+	if config.HashCache != "" {
+		var err error
+		hashCache, err = loadHashCache(config.HashCache)
+		checkErr(err)
+	}
+
+	// 优先使用参数指定的文件夹缓存文件
+	if *dirCacheFile != "" {
+		config.DirCache = *dirCacheFile
+	}
+	if config.DirCache != "" {
+		var err error
+		dirCache, err = loadDirCache(config.DirCache)
+		checkErr(err)
+	}
+
+	// 优先使用参数指定的上传状态文件
+	if *stateFile != "" {
+		config.StateFile = *stateFile
+	}
+	if config.StateFile != "" {
+		var err error
+		uploadState, err = loadUploadState(config.StateFile)
+		checkErr(err)
+	} else if *incremental {
+		log.Println("增量上传需要设置设置文件的 stateFile 或者使用参数 -state")
+		os.Exit(1)
+	}
+
+	// 优先使用参数指定的数量
+	if *hashWorkers != 0 {
+		config.HashWorkers = *hashWorkers
+	}
+	if config.HashWorkers == 0 {
+		config.HashWorkers = 1
+	}
+	if *hashLookahead != 0 {
+		config.HashLookahead = *hashLookahead
+	}
+	if config.HashLookahead == 0 {
+		config.HashLookahead = defaultHashLookahead
+	}
+	if *noLookahead {
+		config.HashLookahead = 0
+	}
+
 	// 优先使用参数指定的 HTTP 请求重试次数
 	if *httpRetry != 0 {
 		config.HTTPRetry = *httpRetry
@@ -558,13 +865,16 @@ func initialize() (e error) {
 		}
 	}
 
-	err := getUserKey()
-	checkErr(err)
+	if !commands[cmdName].noCookies {
+		err := getUserKey()
+		checkErr(err)
+	}
 
-	if len(flag.Args()) != 0 && (*upload || *multipartUpload) {
+	if cmdName == "" && !*dryRun && len(flag.Args()) != 0 && (*upload || *multipartUpload || *autoUpload) {
 		orderFile(config.CID)
 	}
 
+	var err error
 	ecdhCipher, err = cipher.NewEcdhCipher()
 	checkErr(err)
 
@@ -573,6 +883,9 @@ func initialize() (e error) {
 
 func main() {
 	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
 		if len(result.Failed) != 0 {
 			os.Exit(1)
 		}
@@ -583,6 +896,45 @@ func main() {
 	err := initialize()
 	checkErr(err)
 
+	defer hashCache.save()
+	defer dirCache.save()
+	defer uploadState.save()
+
+	if cmdName != "" {
+		err = runCommand()
+		if err != nil {
+			log.Printf("运行子命令 %s 出现错误：%v", cmdName, err)
+		}
+		return
+	}
+
+	snapshotRoot := config.CID
+	snapshotName := time.Now().Format(snapshotLayout) // 演习时显示的快照文件夹的名字
+	if *snapshot {
+		if *dryRun {
+			log.Printf("快照模式会在文件夹 %d 里创建以当前时间命名的快照文件夹 %s", snapshotRoot, snapshotName)
+		} else {
+			config.CID, err = createSnapshot(snapshotRoot)
+			checkErr(err)
+		}
+	}
+
+	if *dryRun {
+		files, err := collectFiles(flag.Args())
+		checkErr(err)
+		plan := newUploadPlan(files)
+		if *snapshot {
+			plan.pendingSnapshot(snapshotName)
+		}
+		plan.print(bandwidth)
+		if *planFile != "" {
+			err = plan.save(*planFile)
+			checkErr(err)
+			log.Printf("上传计划保存在 %s", *planFile)
+		}
+		return
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go getInput(ctx)
@@ -590,87 +942,69 @@ func main() {
 
 	defer exitPrint()
 
-	files := make([]fileInfo, 0, len(flag.Args()))
-	cidMap := make(map[string]uint64)
-	for _, file := range flag.Args() {
+	var files []fileInfo
+	if *applyFile != "" {
+		files, err = loadUploadPlan(*applyFile)
+		if err != nil {
+			log.Printf("读取上传计划 %s 出现错误：%v", *applyFile, err)
+			return
+		}
+	} else {
+		files, err = collectFiles(flag.Args())
+		if err != nil {
+			log.Printf("读取清单 %s 出现错误：%v", *manifestFile, err)
+			return
+		}
+	}
+
+	if !*noQuotaEstimate {
+		if err := checkQuota(files); err != nil {
+			log.Printf("取消上传：%v", err)
+			exitCode = 1
+			return
+		}
+	}
+
+	startHashPipeline(files)
+	for i := range files {
+		// 等待一秒
+		time.Sleep(time.Second)
+		err := files[i].uploadFile()
+		files[i].discardHash()
+		files[i].recordRow(err)
+	}
+	// 等待一秒
+	time.Sleep(time.Second)
+
+	if *shareUpload {
+		shareUploadedDirs()
+	}
+
+	if *snapshot {
+		if len(result.Failed) != 0 {
+			log.Println("有文件上传失败，不删除旧的快照")
+		} else if err := pruneSnapshots(snapshotRoot, config.CID); err != nil {
+			log.Printf("删除旧的快照出现错误：%v", err)
+		}
+	}
+}
+
+// 收集要上传的文件和清单里的文件，递归上传文件夹时在 115 创建对应的文件夹
+func collectFiles(args []string) ([]fileInfo, error) {
+	files := make([]fileInfo, 0, len(args))
+	for _, file := range args {
 		file = filepath.Clean(file)
 		info, err := os.Stat(file)
 		if err != nil {
 			log.Printf("获取 %s 的信息出现错误：%v", file, err)
+			continue
 		}
 
 		if info.IsDir() {
 			// 上传文件夹
 			if *recursive {
-				err = filepath.WalkDir(file, func(path string, d fs.DirEntry, err error) error {
-					if d == nil {
-						return fmt.Errorf("获取文件夹 %s 的信息出现错误，取消上传该文件夹：%w", path, err)
-					}
-
-					path = filepath.Clean(path)
-
-					if d.IsDir() {
-
-						// 等待一秒
-						time.Sleep(time.Second)
-
-						if err != nil {
-							log.Printf("获取文件夹 %s 的信息出现错误，取消上传该文件夹：%v", path, err)
-							return fs.SkipDir
-						}
-
-						if path == file {
-							var filename string
-							if path == "." {
-								abs, err := filepath.Abs(path)
-								if err != nil {
-									return fmt.Errorf("获取文件夹 %s 的绝对路径失败，取消上传该文件夹：%w", path, err)
-								}
-								filename = filepath.Base(abs)
-							} else {
-								filename = filepath.Base(path)
-							}
-
-							cid, err := createDir(config.CID, filename)
-							if err != nil {
-								return err
-							}
-
-							cidMap[path] = cid
-
-							return nil
-						}
-
-						pdir := filepath.Dir(path)
-						if pid, ok := cidMap[pdir]; ok {
-							cid, err := createDir(pid, d.Name())
-
-							if err != nil {
-								return err
-							}
-
-							cidMap[path] = cid
-						} else {
-							return fmt.Errorf("没有创建文件夹 %s ，取消上传 %s", filepath.Base(pdir), path)
-						}
-					} else {
-						if err != nil {
-							log.Printf("获取文件 %s 的信息出现错误，取消上传该文件：%v", path, err)
-							return nil
-						}
-
-						pdir := filepath.Dir(path)
-						if pid, ok := cidMap[pdir]; ok {
-							files = append(files, fileInfo{
-								Path:     path,
-								ParentID: pid,
-							})
-						} else {
-							return fmt.Errorf("没有创建文件夹 %s ，取消上传 %s", filepath.Base(pdir), path)
-						}
-					}
-					return nil
-				})
+				dirFiles, err := walkDir(file, config.CID)
+				files = append(files, dirFiles...)
 				if err != nil {
 					log.Printf("上传文件夹 %s 出现错误：%v", file, err)
 					continue
@@ -679,7 +1013,9 @@ func main() {
 				log.Printf("%s 是文件夹，上传文件夹需要参数 -recursive", file)
 				continue
 			}
-		} else {
+		} else if !info.Mode().IsRegular() {
+			skipped(file, fmt.Sprintf("特殊文件 %s", info.Mode().Type()))
+		} else if !skipUnchanged(file, "", info) {
 			files = append(files, fileInfo{
 				Path:     file,
 				ParentID: config.CID,
@@ -687,76 +1023,113 @@ func main() {
 		}
 	}
 
-	for _, file := range files {
-		// 等待一秒
-		time.Sleep(time.Second)
-		file.uploadFile()
+	if unchangedFiles != 0 {
+		log.Printf("增量上传跳过了 %d 个没有改变的文件", unchangedFiles)
 	}
-	// 等待一秒
-	time.Sleep(time.Second)
+	if dateLayout != "" {
+		files = applyDateLayout(files)
+	}
+
+	if *manifestFile != "" {
+		mfiles, err := manifestFiles(*manifestFile)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, mfiles...)
+	}
+
+	return files, nil
 }
 
-// 上传文件
-func (file *fileInfo) uploadFile() {
+// 上传模式
+const (
+	modeFast      = "fast"      // 秒传模式
+	modeNormal    = "normal"    // 普通模式
+	modeMultipart = "multipart" // 断点续传模式
+)
+
+// 参数指定的上传模式
+func currentMode() string {
 	switch {
 	case *fastUpload:
-		_, err := file.fastUploadFile()
-		if err != nil {
-			log.Printf("秒传模式上传 %s 出现错误：%v", file.Path, err)
-			result.Failed = append(result.Failed, file.Path)
-			return
+		return modeFast
+	case *upload, *autoUpload:
+		// -u 已经按文件大小选择普通模式或者断点续传模式，-auto 和 -u 相同
+		return modeNormal
+	case *multipartUpload:
+		return modeMultipart
+	default:
+		return ""
+	}
+}
+
+// 上传文件使用的上传模式，没有单独指定时使用参数指定的上传模式
+func (file *fileInfo) mode() string {
+	if file.Mode != "" {
+		// 清单里的上传模式可以是 f、u、m 和 auto 等简写
+		if m, ok := modeAliases[file.Mode]; ok {
+			return m
 		}
-		result.Success = append(result.Success, file.Path)
-	case *upload:
+		return file.Mode
+	}
+	return currentMode()
+}
+
+// 上传文件，返回上传出现的错误
+func (file *fileInfo) uploadFile() error {
+	file.start = time.Now().Unix()
+	switch file.mode() {
+	case modeFast:
 		token, err := file.fastUploadFile()
 		if err != nil {
 			log.Printf("秒传模式上传 %s 出现错误：%v", file.Path, err)
-			log.Printf("现在开始使用普通模式上传 %s", file.Path)
-			err := ossUploadFile(token, file.Path)
+			// 空文件不需要上传数据，秒传失败时直接用普通模式创建
+			if token != nil && token.Bucket != "" && token.SHA1 == emptySHA1 {
+				log.Printf("%s 是空文件，现在开始使用普通模式上传", file.Path)
+				err = ossUploadFile(token, file.Path)
+			}
 			if err != nil {
-				log.Printf("普通模式上传 %s 出现错误：%v", file.Path, err)
 				result.Failed = append(result.Failed, file.Path)
-				return
+				return err
 			}
 		}
 		result.Success = append(result.Success, file.Path)
-	case *multipartUpload:
-		// 存档文件保存在设置文件所在文件夹内
-		saveFile := filepath.Join(*saveDir, filepath.Base(file.Path)+".json")
-		info, err := os.Stat(saveFile)
-		if os.IsNotExist(err) {
-			token, err := file.fastUploadFile()
-			if err != nil {
-				log.Printf("秒传模式上传 %s 出现错误：%v", file.Path, err)
-				log.Println("现在开始使用断点续传模式上传")
-				err := multipartUploadFile(token, file.Path, nil)
-				if err != nil {
-					if errors.Is(err, errStopUpload) {
-						return
-					}
-					log.Printf("断点续传模式上传 %s 出现错误：%v", file.Path, err)
-					result.Failed = append(result.Failed, file.Path)
-					return
-				}
-			}
-			result.Success = append(result.Success, file.Path)
-		} else {
-			if info.IsDir() {
-				log.Printf("%s 不能是文件夹", saveFile)
-				result.Failed = append(result.Failed, file.Path)
-				return
+	case modeNormal:
+		err := file.normalUploadFile()
+		if err != nil {
+			if errors.Is(err, errStopUpload) {
+				return err
 			}
-			log.Printf("发现文件 %s 的上传曾经中断过，现在开始断点续传", file.Path)
-			err := resumeUpload(file.Path)
-			if err != nil {
-				if errors.Is(err, errStopUpload) {
-					return
-				}
-				log.Printf("断点续传模式上传 %s 出现错误：%v", file.Path, err)
-				result.Failed = append(result.Failed, file.Path)
-				return
+			log.Printf("普通模式上传 %s 出现错误：%v", file.Path, err)
+			result.Failed = append(result.Failed, file.Path)
+			return err
+		}
+		result.Success = append(result.Success, file.Path)
+	case modeMultipart:
+		err := file.multipartUpload()
+		if err != nil {
+			if errors.Is(err, errStopUpload) {
+				return err
 			}
-			result.Success = append(result.Success, file.Path)
+			log.Printf("断点续传模式上传 %s 出现错误：%v", file.Path, err)
+			result.Failed = append(result.Failed, file.Path)
+			return err
 		}
+		result.Success = append(result.Success, file.Path)
+	default:
+		return fmt.Errorf("%s 没有指定上传模式", file.Path)
 	}
+
+	file.recordState()
+	if *shareUpload {
+		file.share()
+	}
+	if *removeFile || *doneDir != "" {
+		// 删除原文件失败不影响上传结果
+		if err := file.removeSource(); err != nil {
+			log.Printf("%s 上传成功，但是没有删除原文件：%v", file.Path, err)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/orzogc/fake115uploader/cipher"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// 把数据压缩成只有字面量的 lz4 块，和 115 加密后的响应体格式一样
+func lz4Literals(data []byte) []byte {
+	block := []byte{0xf0}
+	n := len(data) - 15
+	for ; n >= 255; n -= 255 {
+		block = append(block, 255)
+	}
+	block = append(block, byte(n))
+	block = append(block, data...)
+	return append([]byte{byte(len(block)), byte(len(block) >> 8)}, block...)
+}
+
+// 模拟 115 和 OSS 的接口，记录上传文件时调用的接口
+type fakeUploadServer struct {
+	mu    sync.Mutex
+	calls []string // 调用过的接口
+	name  string   // 上传的文件名
+	sha1  string   // 上传的文件的 sha1 值
+	size  int64    // 上传的文件大小
+}
+
+func (s *fakeUploadServer) call(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, name)
+}
+
+// 115 的接口
+func (s *fakeUploadServer) roundTrip(req *http.Request, endpoint string) (*http.Response, error) {
+	var body []byte
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/4.0/initupload.php"):
+		s.call("initupload")
+		data := []byte(`{"status":1,"statuscode":0,"bucket":"fake","object":"object","target":"U_1_0",` +
+			`"callback":{"callback":"cb","callback_var":"var"}}`)
+		encrypted, err := ecdhCipher.Encrypt(lz4Literals(data))
+		if err != nil {
+			return nil, err
+		}
+		body = encrypted
+	case req.URL.Path == "/3.0/getuploadinfo.php":
+		body = []byte(fmt.Sprintf(`{"endpoint":%q,"gettokenurl":"https://uplb.115.com/3.0/gettoken.php"}`, endpoint))
+	case req.URL.Path == "/3.0/gettoken.php":
+		body = []byte(fmt.Sprintf(`{"StatusCode":"200","AccessKeyId":"id","AccessKeySecret":"secret","SecurityToken":"token","Expiration":%q}`,
+			time.Now().Add(time.Hour).UTC().Format(time.RFC3339)))
+	case req.URL.Host == "webapi.115.com" && req.URL.Path == "/files":
+		body = []byte(fmt.Sprintf(`{"state":true,"count":1,"data":[{"fid":"1","n":%q,"s":%d,"sha":%q,"tp":%d}]}`,
+			s.name, s.size, s.sha1, time.Now().Unix()))
+	default:
+		return nil, fmt.Errorf("unexpected request: %s", req.URL)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    req,
+	}, nil
+}
+
+// OSS 的接口
+func (s *fakeUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, r.Body)
+	switch {
+	case r.Method == http.MethodPut && r.URL.RawQuery == "":
+		s.call("oss put")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"state":true}`))
+	case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+		s.call("oss multipart")
+		w.WriteHeader(http.StatusForbidden)
+	default:
+		s.call(r.Method + " " + r.URL.String())
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestUploadFileSmallFileModes(t *testing.T) {
+	defer func(c *http.Client, cfg uploadConfig, ec *cipher.EcdhCipher, r resultData) {
+		httpClient, config, ecdhCipher, result = c, cfg, ec, r
+	}(httpClient, config, ecdhCipher, result)
+
+	var err error
+	if ecdhCipher, err = cipher.NewEcdhCipher(); err != nil {
+		t.Fatal(err)
+	}
+	verbose, checkHash, internal = new(bool), new(bool), new(bool)
+	shareUpload, removeFile, doneDir = new(bool), new(bool), new(string)
+	fastUpload, upload, autoUpload, multipartUpload = new(bool), new(bool), new(bool), new(bool)
+	saveDir = new(string)
+	*saveDir = t.TempDir()
+	config = uploadConfig{CID: 1}
+
+	s := new(fakeUploadServer)
+	oss := httptest.NewServer(s)
+	defer oss.Close()
+	httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return s.roundTrip(req, oss.URL)
+	})}
+
+	dir := t.TempDir()
+	tests := []struct {
+		mode    string
+		size    int
+		want    []string
+		success bool
+	}{
+		// 空文件和小于 1KB 的文件秒传失败后都用普通模式上传
+		{modeFast, 0, []string{"initupload", "oss put"}, true},
+		{modeNormal, 0, []string{"initupload", "oss put"}, true},
+		{modeNormal, 1024, []string{"initupload", "oss put"}, true},
+		{modeMultipart, 0, []string{"initupload", "oss put"}, true},
+		{modeMultipart, 1024, []string{"initupload", "oss put"}, true},
+		// 大于 1KB 的文件用断点续传模式上传
+		{modeMultipart, 1025, []string{"initupload", "oss multipart"}, false},
+		// 秒传模式不上传非空文件的数据
+		{modeFast, 1024, []string{"initupload"}, false},
+	}
+	for _, tt := range tests {
+		*fastUpload, *upload, *multipartUpload = tt.mode == modeFast, tt.mode == modeNormal, tt.mode == modeMultipart
+		name := fmt.Sprintf("%s-%d.txt", tt.mode, tt.size)
+		path := filepath.Join(dir, name)
+		data := []byte(strings.Repeat("a", tt.size))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha1.Sum(data)
+		s.calls, s.name, s.sha1, s.size = nil, name, strings.ToUpper(hex.EncodeToString(sum[:])), int64(tt.size)
+		result = resultData{}
+
+		file := &fileInfo{Path: path, ParentID: 1}
+		err := file.uploadFile()
+		if !reflect.DeepEqual(s.calls, tt.want) {
+			t.Errorf("-%s with %d bytes file calls want: %v, result: %v", tt.mode, tt.size, tt.want, s.calls)
+		}
+		if (err == nil) != tt.success || reflect.DeepEqual(result.Success, []string{path}) != tt.success {
+			t.Errorf("-%s with %d bytes file success want: %v, error: %v", tt.mode, tt.size, tt.success, err)
+		}
+	}
+}
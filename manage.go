@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 115 网盘里的文件或文件夹
+type remoteEntry struct {
+	Source string `json:"source"` // 命令行参数指定的路径或 id
+	ID     string `json:"id"`     // 文件的 id 或者文件夹的 cid
+	Name   string `json:"name"`   // 文件名或文件夹名，用 id 指定时为空
+	Parent uint64 `json:"parent"` // 所在的文件夹的 cid，用 id 指定时为 0
+	IsDir  bool   `json:"isDir"`  // 是否是文件夹
+}
+
+// 子命令的操作结果
+type manageResult struct {
+	Action  string        `json:"action"`           // 操作
+	Entries []remoteEntry `json:"entries"`          // 操作的文件或文件夹
+	Target  uint64        `json:"target,omitempty"` // 移动或复制到的文件夹的 cid
+	Names   []string      `json:"names,omitempty"`  // 重命名后的名字
+	Error   string        `json:"error,omitempty"`  // 出现的错误
+}
+
+// 解析 115 网盘里的文件或文件夹的 id（以 id: 开头）或路径，以 / 开头的路径从根目录开始，否则从 -c 指定的文件夹开始
+func resolveRemoteEntry(s string) (remoteEntry, error) {
+	entry := remoteEntry{Source: s}
+	if id, ok, err := parseRemoteID(s); ok {
+		if err == nil {
+			entry.ID = strconv.FormatUint(id, 10)
+		}
+		return entry, err
+	}
+
+	p := path.Clean(s)
+	dir, name := path.Dir(p), path.Base(p)
+	if name == "/" || name == "." {
+		return entry, fmt.Errorf("%s 不是文件或文件夹的路径", s)
+	}
+	pid, err := resolveRemoteDir(dir)
+	if err != nil {
+		return entry, err
+	}
+	dirs, files, err := listRemote(pid)
+	if err != nil {
+		return entry, err
+	}
+	entry.Name = name
+	entry.Parent = pid
+	for _, d := range dirs {
+		if d.Name == name {
+			entry.ID = strconv.FormatUint(d.CID, 10)
+			entry.IsDir = true
+			return entry, nil
+		}
+	}
+	for _, f := range files {
+		if f.Name == name {
+			entry.ID = f.FID
+			return entry, nil
+		}
+	}
+	return entry, fmt.Errorf("115 里没有 %s", s)
+}
+
+// 解析多个文件或文件夹
+func resolveRemoteEntries(args []string) ([]remoteEntry, error) {
+	entries := make([]remoteEntry, 0, len(args))
+	for _, arg := range args {
+		entry, err := resolveRemoteEntry(arg)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// 文件或文件夹的 id
+func entryIDs(entries []remoteEntry) []string {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+// 文件夹被移动、重命名或删除后删除其缓存
+func invalidateEntries(entries []remoteEntry) {
+	for _, entry := range entries {
+		if cid, err := strconv.ParseUint(entry.ID, 10, 64); err == nil {
+			dirCache.invalidate(cid)
+		}
+	}
+}
+
+// 输出操作结果
+func printManageResult(r *manageResult, err error) error {
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if *jsonOutput {
+		if e := printJSON(r); e != nil {
+			return e
+		}
+	} else if err == nil {
+		for i, entry := range r.Entries {
+			switch r.Action {
+			case "mv":
+				log.Printf("移动 %s（%s）到文件夹 %d 成功", entry.Source, entry.ID, r.Target)
+			case "cp":
+				log.Printf("复制 %s（%s）到文件夹 %d 成功", entry.Source, entry.ID, r.Target)
+			case "rename":
+				log.Printf("将 %s（%s）重命名为 %s 成功", entry.Source, entry.ID, r.Names[i])
+			case "rm":
+				log.Printf("删除 %s（%s）成功", entry.Source, entry.ID)
+			}
+		}
+	}
+	return err
+}
+
+// mv 和 cp 子命令，最后一个参数是目标文件夹
+func transferCommand(action string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("用法：%s 文件或文件夹... 目标文件夹", action)
+	}
+	target, err := resolveRemoteDir(args[len(args)-1])
+	if err != nil {
+		return err
+	}
+	entries, err := resolveRemoteEntries(args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	form.Set("pid", strconv.FormatUint(target, 10))
+	reqURL := moveURL
+	if action == "cp" {
+		reqURL = copyURL
+	}
+	err = postIDs(reqURL, form, entryIDs(entries))
+	if err == nil && action == "mv" {
+		invalidateEntries(entries)
+	}
+	return printManageResult(&manageResult{Action: action, Entries: entries, Target: target}, err)
+}
+
+// mv 子命令，移动 115 里的文件或文件夹
+func mvCommand(args []string) error {
+	return transferCommand("mv", args)
+}
+
+// cp 子命令，复制 115 里的文件或文件夹
+func cpCommand(args []string) error {
+	return transferCommand("cp", args)
+}
+
+// 解析 rename 子命令的参数，返回要重命名的文件或文件夹和对应的新名字
+func parseRenameArgs(args []string) (srcs, names []string, e error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, nil, errors.New("用法：rename 文件或文件夹 新名字 [文件或文件夹 新名字...]")
+	}
+	srcs = make([]string, 0, len(args)/2)
+	names = make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name := args[i+1]
+		if strings.ContainsAny(name, `/\`) {
+			return nil, nil, fmt.Errorf("新名字 %s 不能包含 / 或 \\", name)
+		}
+		if s := sanitizeName(name); s != name {
+			return nil, nil, fmt.Errorf("新名字 %s 包含 115 不允许的字符或者太长，可以改为 %s", name, s)
+		}
+		srcs = append(srcs, args[i])
+		names = append(names, name)
+	}
+	return srcs, names, nil
+}
+
+// rename 子命令，参数是成对的文件或文件夹和新名字
+func renameCommand(args []string) error {
+	srcs, names, err := parseRenameArgs(args)
+	if err != nil {
+		return err
+	}
+	entries, err := resolveRemoteEntries(srcs)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	for i, entry := range entries {
+		form.Set(fmt.Sprintf("files_new_name[%s]", entry.ID), names[i])
+	}
+	v, err := postFormJSON(renameURL, form.Encode())
+	if err == nil && !v.GetBool("state") {
+		err = fmt.Errorf("操作失败：%s", v.GetStringBytes("error"))
+	}
+	if err == nil {
+		invalidateEntries(entries)
+	}
+	return printManageResult(&manageResult{Action: "rename", Entries: entries, Names: names}, err)
+}
+
+// 将文件或文件夹按所在的文件夹分组，parents 按第一次出现的顺序排列
+func groupByParent(entries []remoteEntry) (parents []uint64, byParent map[uint64][]remoteEntry) {
+	byParent = make(map[uint64][]remoteEntry)
+	for _, entry := range entries {
+		if _, ok := byParent[entry.Parent]; !ok {
+			parents = append(parents, entry.Parent)
+		}
+		byParent[entry.Parent] = append(byParent[entry.Parent], entry)
+	}
+	return parents, byParent
+}
+
+// rm 子命令，删除 115 里的文件或文件夹
+func rmCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法：rm 文件或文件夹...")
+	}
+	entries, err := resolveRemoteEntries(args)
+	if err != nil {
+		return err
+	}
+
+	// 按所在的文件夹批量删除
+	parents, byParent := groupByParent(entries)
+	var errs []error
+	for _, pid := range parents {
+		group := byParent[pid]
+		if err := deleteRemote(pid, entryIDs(group)...); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		invalidateEntries(group)
+	}
+	return printManageResult(&manageResult{Action: "rm", Entries: entries}, errors.Join(errs...))
+}
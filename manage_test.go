@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRenameArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		srcs  []string
+		names []string
+		err   bool
+	}{
+		{[]string{"/a.txt", "b.txt"}, []string{"/a.txt"}, []string{"b.txt"}, false},
+		{[]string{"1", "x", "/dir", "新名字"}, []string{"1", "/dir"}, []string{"x", "新名字"}, false},
+		{nil, nil, nil, true},
+		{[]string{"/a.txt"}, nil, nil, true},
+		{[]string{"/a.txt", "b.txt", "/c.txt"}, nil, nil, true},
+		{[]string{"/a.txt", "sub/b.txt"}, nil, nil, true},
+		{[]string{"/a.txt", `sub\b.txt`}, nil, nil, true},
+		{[]string{"/a.txt", "a&b.txt"}, nil, nil, true},
+		{[]string{"/a.txt", "a:b.txt"}, nil, nil, true},
+		{[]string{"/a.txt", " b.txt"}, nil, nil, true},
+		{[]string{"/a.txt", ".."}, nil, nil, true},
+		{[]string{"/a.txt", strings.Repeat("a", maxNameLen+1)}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		srcs, names, err := parseRenameArgs(tt.args)
+		if (err != nil) != tt.err {
+			t.Errorf("parse rename args %q want error: %v, result: %v", tt.args, tt.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(srcs, tt.srcs) || !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("parse rename args %q want: %q %q, result: %q %q", tt.args, tt.srcs, tt.names, srcs, names)
+		}
+	}
+}
+
+func TestResolveRemoteEntryID(t *testing.T) {
+	entry, err := resolveRemoteEntry("id:12345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (remoteEntry{Source: "id:12345", ID: "12345"}); entry != want {
+		t.Errorf("entry want: %+v, result: %+v", want, entry)
+	}
+
+	for _, s := range []string{"/", ".", "//", "id:", "id:abc"} {
+		if _, err := resolveRemoteEntry(s); err == nil {
+			t.Errorf("resolve %q should fail", s)
+		}
+	}
+}
+
+func TestResolveRemoteEntryPath(t *testing.T) {
+	defer func(c *http.Client, cfg uploadConfig) { httpClient, config = c, cfg }(httpClient, config)
+	config = uploadConfig{CID: 7}
+	httpClient = fakeListClient(map[string]string{
+		"7":   `[{"cid":"555","n":"2024"},{"fid":"900","n":"123","s":"1","sha":"A"}]`,
+		"555": `[{"fid":"901","n":"a.txt","s":"1","sha":"B"}]`,
+	})
+
+	// 数字名字的文件和文件夹按照路径查找，不当成 id
+	tests := []struct {
+		s    string
+		want remoteEntry
+	}{
+		{"2024", remoteEntry{Source: "2024", ID: "555", Name: "2024", Parent: 7, IsDir: true}},
+		{"123", remoteEntry{Source: "123", ID: "900", Name: "123", Parent: 7}},
+		{"2024/a.txt", remoteEntry{Source: "2024/a.txt", ID: "901", Name: "a.txt", Parent: 555}},
+	}
+	for _, tt := range tests {
+		entry, err := resolveRemoteEntry(tt.s)
+		if err != nil || entry != tt.want {
+			t.Errorf("resolve %q want: %+v, result: %+v, error: %v", tt.s, tt.want, entry, err)
+		}
+	}
+	if _, err := resolveRemoteEntry("2025"); err == nil {
+		t.Error("resolve missing numeric name should fail instead of using it as id")
+	}
+}
+
+func TestGroupByParent(t *testing.T) {
+	entries := []remoteEntry{
+		{ID: "1", Parent: 10},
+		{ID: "2", Parent: 20},
+		{ID: "3", Parent: 10},
+		{ID: "4", Parent: 0},
+		{ID: "5", Parent: 20},
+	}
+	parents, byParent := groupByParent(entries)
+	if want := []uint64{10, 20, 0}; !reflect.DeepEqual(parents, want) {
+		t.Errorf("parents want: %v, result: %v", want, parents)
+	}
+	want := map[uint64][]string{10: {"1", "3"}, 20: {"2", "5"}, 0: {"4"}}
+	for pid, ids := range want {
+		if result := entryIDs(byParent[pid]); !reflect.DeepEqual(result, ids) {
+			t.Errorf("entries in %d want: %v, result: %v", pid, ids, result)
+		}
+	}
+	if len(byParent) != len(want) {
+		t.Errorf("groups want: %d, result: %d", len(want), len(byParent))
+	}
+}
+
+func TestInvalidateEntries(t *testing.T) {
+	verbose = new(bool)
+	defer func(dc *dirCacheData) { dirCache = dc }(dirCache)
+	dirCache = newDirCache(filepath.Join(t.TempDir(), "dirs.json"))
+	dirCache.put(0, "a", 1)
+	dirCache.put(1, "b", 2)
+	dirCache.put(0, "c", 3)
+	dirCache.put(0, "d", 4)
+
+	invalidateEntries([]remoteEntry{
+		{Source: "/a", ID: "1", IsDir: true},
+		{Source: "3", ID: "3"},
+		{Source: "/e.txt", ID: "abc"},
+	})
+	for _, key := range []string{dirKey(0, "a"), dirKey(1, "b"), dirKey(0, "c")} {
+		if _, ok := dirCache.Dirs[key]; ok {
+			t.Errorf("%s should be invalidated", key)
+		}
+	}
+	if cid, ok := dirCache.get(0, "d"); !ok || cid != 4 {
+		t.Errorf("cid of d want: 4, result: %d", cid)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 清单里每一行的上传状态
+const (
+	rowSuccess = "上传成功"
+	rowFailed  = "上传失败"
+	rowSaved   = "保存上传进度"
+)
+
+// 清单里一行的上传结果
+type rowResult struct {
+	Row    int    `json:"row"`             // 行号
+	Path   string `json:"path"`            // 本地文件路径
+	CID    uint64 `json:"cid"`             // 要上传到的文件夹的 cid
+	Status string `json:"status"`          // 上传状态
+	Error  string `json:"error,omitempty"` // 出现的错误
+}
+
+// 清单里的一行
+type manifestRow struct {
+	Line   int    `json:"-"`      // 行号
+	Local  string `json:"local"`  // 本地文件路径
+	Remote string `json:"remote"` // 要上传到的 115 文件夹的 cid 或路径
+	Name   string `json:"name"`   // 上传后的文件名
+	Mode   string `json:"mode"`   // 上传模式
+}
+
+// 上传模式的简写
+var modeAliases = map[string]string{
+	"f": modeFast,
+	"u": modeNormal,
+	"m": modeMultipart,
+	// 自动选择上传模式和 -u 相同
+	"auto": modeNormal,
+}
+
+// 解析清单，每一行是一个 json 对象或者 CSV 格式的“本地文件路径,115 文件夹的 cid 或路径,文件名,上传模式”，
+// 以 # 开头的行和空行会被忽略
+func parseManifest(r io.Reader) ([]manifestRow, error) {
+	br := bufio.NewReader(r)
+	// 跳过开头的空白和注释，根据第一个字符判断格式
+	line := 1
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		switch {
+		case b[0] == '#':
+			if _, err := br.ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			line++
+			continue
+		case !bytes.ContainsAny(b, " \t\r\n"):
+			if b[0] == '{' {
+				return parseJSONManifest(br, line)
+			}
+			return parseCSVManifest(br, line)
+		case b[0] == '\n':
+			line++
+		}
+		_, _ = br.ReadByte()
+	}
+}
+
+// 解析 json lines 格式的清单，line 是第一行的行号
+func parseJSONManifest(r io.Reader, line int) ([]manifestRow, error) {
+	var rows []manifestRow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for ; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var v struct {
+			manifestRow
+			// remote 可以是 cid 数字或者路径字符串，cid 太大不能用 float64 保存
+			Remote json.RawMessage `json:"remote"`
+		}
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("清单第 %d 行的格式错误：%w", line, err)
+		}
+		row := v.manifestRow
+		row.Line = line
+		if len(v.Remote) != 0 && v.Remote[0] == '"' {
+			if err := json.Unmarshal(v.Remote, &row.Remote); err != nil {
+				return nil, fmt.Errorf("清单第 %d 行的格式错误：%w", line, err)
+			}
+		} else if string(v.Remote) != "null" {
+			row.Remote = string(v.Remote)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// 解析 CSV 格式的清单，第一行的第一列是 local 时作为表头忽略，start 是第一行的行号
+func parseCSVManifest(r io.Reader, start int) ([]manifestRow, error) {
+	var rows []manifestRow
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("清单的格式错误：%w", err)
+		}
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "local") {
+			continue
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := manifestRow{Line: start + line - 1}
+		for i, field := range []*string{&row.Local, &row.Remote, &row.Name, &row.Mode} {
+			if i < len(record) {
+				*field = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// 解析清单里的上传模式，为空时使用参数指定的上传模式
+func parseMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if m, ok := modeAliases[mode]; ok {
+		return m, nil
+	}
+	switch mode {
+	case "":
+		if currentMode() == "" {
+			return "", errors.New("没有指定上传模式")
+		}
+		return "", nil
+	case modeFast, modeNormal, modeMultipart:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("不支持的上传模式 %s", mode)
+	}
+}
+
+// 读取清单，返回要上传的文件，清单里有错误的行会记录在上传结果里
+func manifestFiles(file string) ([]fileInfo, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rows, err := parseManifest(f)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := newRemoteDirs(config.CID)
+	files := make([]fileInfo, 0, len(rows))
+	for _, row := range rows {
+		fi, err := row.fileInfo(dirs)
+		if err != nil {
+			log.Printf("清单第 %d 行 %s 出现错误：%v", row.Line, row.Local, err)
+			result.Failed = append(result.Failed, fi.Path)
+			fi.recordRow(err)
+			continue
+		}
+		files = append(files, fi)
+	}
+
+	return files, nil
+}
+
+// 将清单里的一行转换为要上传的文件，需要时在 115 创建要上传到的文件夹
+func (row *manifestRow) fileInfo(dirs *remoteDirs) (fi fileInfo, e error) {
+	fi = fileInfo{
+		Path:     filepath.Clean(row.Local),
+		ParentID: config.CID,
+		Name:     row.Name,
+		Row:      row.Line,
+	}
+	if row.Local == "" {
+		return fi, errors.New("没有指定本地文件")
+	}
+	if strings.ContainsAny(row.Name, `/\`) {
+		return fi, fmt.Errorf("文件名 %s 不能包含 / 或 \\", row.Name)
+	}
+
+	mode, err := parseMode(row.Mode)
+	if err != nil {
+		return fi, err
+	}
+	fi.Mode = mode
+
+	info, err := os.Stat(fi.Path)
+	if err != nil {
+		return fi, err
+	}
+	if !info.Mode().IsRegular() {
+		return fi, fmt.Errorf("%s 不是普通文件", fi.Path)
+	}
+
+	remote := strings.TrimSpace(row.Remote)
+	if cid, err := strconv.ParseUint(remote, 10, 64); err == nil {
+		fi.ParentID = cid
+		return fi, nil
+	}
+	if remote == "" {
+		return fi, nil
+	}
+
+	err = fi.setRemoteDir(dirs, filepath.ToSlash(remote))
+	return fi, err
+}
+
+// 设置要上传到的 115 文件夹的路径，需要时创建文件夹，演习时只从缓存里查找文件夹
+func (file *fileInfo) setRemoteDir(dirs *remoteDirs, dir string) error {
+	file.RemoteDir = path.Clean(dir)
+	if *dryRun {
+		cid, ok := dirs.lookup(file.RemoteDir)
+		file.ParentID = cid
+		file.dirPending = !ok
+		return nil
+	}
+
+	cid, err := dirs.create(file.RemoteDir)
+	if err != nil {
+		return fmt.Errorf("创建文件夹 %s 出现错误：%w", file.RemoteDir, err)
+	}
+	file.ParentID = cid
+	return nil
+}
+
+// 记录清单里的文件的上传结果，不是来自清单的文件不用记录
+func (file *fileInfo) recordRow(err error) {
+	if file.Row == 0 {
+		return
+	}
+
+	r := rowResult{
+		Row:    file.Row,
+		Path:   file.Path,
+		CID:    file.ParentID,
+		Status: rowSuccess,
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, errStopUpload):
+		r.Status = rowSaved
+	default:
+		r.Status = rowFailed
+		r.Error = err.Error()
+	}
+	result.Rows = append(result.Rows, r)
+}
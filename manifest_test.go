@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	want := []manifestRow{
+		{Line: 3, Local: "a.txt", Remote: "12345678901234567890"},
+		{Line: 4, Local: "b.txt", Remote: "/Photos/2024", Name: "c.txt", Mode: "m"},
+	}
+
+	jsonl := "\n# comment\n" +
+		`{"local": "a.txt", "remote": 12345678901234567890}` + "\n" +
+		`{"local": "b.txt", "remote": "/Photos/2024", "name": "c.txt", "mode": "m"}` + "\n"
+	rows, err := parseManifest(strings.NewReader(jsonl))
+	if err != nil {
+		t.Errorf("parse json lines manifest error: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("json lines rows want: %+v, result: %+v", want, rows)
+	}
+
+	csv := "\nlocal,remote,name,mode\na.txt,12345678901234567890\nb.txt, /Photos/2024, c.txt, m\n"
+	rows, err = parseManifest(strings.NewReader(csv))
+	if err != nil {
+		t.Errorf("parse csv manifest error: %v", err)
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("csv rows want: %+v, result: %+v", want, rows)
+	}
+
+	if _, err := parseManifest(strings.NewReader("{bad json}\n")); err == nil {
+		t.Error("parse bad json manifest should fail")
+	}
+}
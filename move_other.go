@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// 判断是否因为跨设备而不能直接移动文件
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+var crossDeviceErr error = syscall.EXDEV // 跨设备移动文件的错误
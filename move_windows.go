@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows 移动文件到其他盘时返回的错误码 ERROR_NOT_SAME_DEVICE
+const errorNotSameDevice syscall.Errno = 17
+
+// 判断是否因为跨设备而不能直接移动文件
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errorNotSameDevice)
+}
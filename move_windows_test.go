@@ -0,0 +1,5 @@
+//go:build windows
+
+package main
+
+var crossDeviceErr error = errorNotSameDevice // 跨设备移动文件的错误
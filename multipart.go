@@ -17,12 +17,18 @@ import (
 	"github.com/cheggaaa/pb/v3"
 )
 
+// 上传的 upload ID 已失效（过期或者被取消）
+var errNoSuchUpload = errors.New("断点续传的上传已失效")
+
+var cleanupAll *bool // cleanup 子命令不指定存档文件时也取消还可以继续的上传
+
 // 上传进度存档文件的数据
 type saveProgress struct {
 	FastToken *fastToken
 	Chunks    []oss.FileChunk
 	Imur      oss.InitiateMultipartUploadResult
 	Parts     []oss.UploadPart
+	File      string // 上传的文件的路径
 }
 
 // 进度监听
@@ -41,25 +47,175 @@ func (listener *multipartProgressListener) ProgressChanged(event *oss.ProgressEv
 	}
 }
 
-// 获取 ossToken 和 bucket
-func getBucket(bucketName string) (ot *ossToken, bucket *oss.Bucket, e error) {
+// 获取自动刷新 ossToken 的凭证和 bucket
+func getBucket(bucketName string) (cp *ossCredentialsProvider, bucket *oss.Bucket, e error) {
 	defer func() {
 		if err := recover(); err != nil {
 			e = fmt.Errorf("getBucket() error: %v", err)
 		}
 	}()
 
-	ot, err := getOSSToken()
+	cp, err := newOSSCredentialsProvider()
 	checkErr(err)
-	client, err := oss.New(ot.endpoint, ot.AccessKeyID, ot.AccessKeySecret, getClientOptions()...)
+	options := append(getClientOptions(), oss.SetCredentialsProvider(cp))
+	client, err := oss.New(cp.token.endpoint, "", "", options...)
 	checkErr(err)
 	bucket, err = client.Bucket(bucketName)
 	checkErr(err)
-	return ot, bucket, nil
+	return cp, bucket, nil
+}
+
+// 存档文件的路径
+func saveFilePath(file string) string {
+	return filepath.Join(*saveDir, filepath.Base(file)+".json")
+}
+
+// 读取存档文件
+func readSaveFile(saveFile string) (sp *saveProgress, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("readSaveFile() error: %v", err)
+		}
+	}()
+
+	data, err := os.ReadFile(saveFile)
+	checkErr(err)
+	sp = new(saveProgress)
+	err = json.Unmarshal(data, sp)
+	checkErr(err)
+	if sp.FastToken == nil || sp.Imur.UploadID == "" {
+		return nil, fmt.Errorf("%s 不是断点续传模式的存档文件", saveFile)
+	}
+
+	return sp, nil
+}
+
+// 计算文件的分片
+func splitFile(file string, size int64) (chunks []oss.FileChunk, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("splitFile() error: %v", err)
+		}
+	}()
+
+	// 是否指定分片数量
+	if config.PartsNum != 0 {
+		chunks, err := oss.SplitFileByPartNum(file, int(config.PartsNum))
+		checkErr(err)
+		return checkChunks(file, chunks)
+	}
+	for i := int64(1); i < 10; i++ {
+		if size < i*1024*1024*1024 {
+			// 文件大小小于 iGB 时分为 i*1000 片
+			chunks, err := oss.SplitFileByPartNum(file, int(i*1000))
+			checkErr(err)
+			return checkChunks(file, chunks)
+		}
+	}
+	// 文件大小大于 9GB 时分为 10000 片
+	chunks, err := oss.SplitFileByPartNum(file, maxParts)
+	checkErr(err)
+	return checkChunks(file, chunks)
+}
+
+// 单个分片大小不能小于 100KB
+func checkChunks(file string, chunks []oss.FileChunk) ([]oss.FileChunk, error) {
+	if chunks[0].Size < 100*1024 {
+		return oss.SplitFileByPartSize(file, 100*1024)
+	}
+	return chunks, nil
+}
+
+// 指定大小的文件在秒传失败后是否会使用断点续传模式上传
+func willMultipart(mode string, size int64) bool {
+	switch mode {
+	case modeMultipart:
+		return size > 1024
+	case modeNormal:
+		return useMultipart(size)
+	default:
+		return false
+	}
+}
+
+// 以断点续传模式上传文件，存在存档文件时恢复上传，上传已失效时重新开始上传
+func (file *fileInfo) multipartUpload() error {
+	return restartUpload(file.Path, saveFilePath(file.Path),
+		func() error {
+			return resumeUpload(file.Path)
+		},
+		func() error {
+			token, err := file.fastUploadFile()
+			if err == nil {
+				return nil
+			}
+			log.Printf("秒传模式上传 %s 出现错误：%v", file.Path, err)
+			log.Println("现在开始使用断点续传模式上传")
+			return multipartUploadFile(token, file.Path, nil)
+		})
+}
+
+// 存在存档文件时用 resume 恢复上传，上传已失效时用 upload 重新开始上传，
+// 重新上传期间 upload ID 失效的话只再重新上传一次
+func restartUpload(file, saveFile string, resume, upload func() error) error {
+	info, err := os.Stat(saveFile)
+	if err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s 不能是文件夹", saveFile)
+		}
+		log.Printf("发现文件 %s 的上传曾经中断过，现在开始断点续传", file)
+		err = resume()
+		if !errors.Is(err, errNoSuchUpload) {
+			return err
+		}
+		log.Printf("%s 的断点续传已失效，现在重新开始上传", file)
+	}
+
+	for i := 0; i < 2; i++ {
+		err := upload()
+		if !errors.Is(err, errNoSuchUpload) {
+			return err
+		}
+		log.Printf("%s 的断点续传已失效，现在重新开始上传", file)
+	}
+
+	return errNoSuchUpload
 }
 
 // 利用 oss 的接口以 multipart 的方式上传文件，sp 不为 nil 时恢复上次的上传
 func multipartUploadFile(ft *fastToken, file string, sp *saveProgress) (e error) {
+	var imur oss.InitiateMultipartUploadResult
+	var chunks []oss.FileChunk
+	var parts []oss.UploadPart
+	completed := false // CompleteMultipartUpload 是否已经成功
+	// 存档文件保存在设置文件所在文件夹内
+	saveFile := saveFilePath(file)
+	defer func() {
+		if e == nil || errors.Is(e, errStopUpload) || errors.Is(e, errNoSuchUpload) || imur.UploadID == "" {
+			return
+		}
+		switch {
+		case completed:
+			// 上传已经完成，存档文件已经没有用
+			removeSaveFile(saveFile)
+		case sp == nil && len(parts) == 0:
+			// 还没有上传任何分片时取消上传，避免 OSS 上残留没完成的上传
+			if err := abortUpload(ft.Bucket, imur); err != nil {
+				log.Printf("取消 %s 的上传出现错误：%v", file, err)
+				return
+			}
+			log.Printf("已取消 %s 的上传", file)
+		default:
+			// 已经上传了分片时保存上传进度，之后可以继续上传，或者用 cleanup 子命令取消上传
+			log.Printf("断点续传模式上传 %s 出现错误：%v", file, e)
+			err := saveUploadProgress(saveFile, &saveProgress{FastToken: ft, Chunks: chunks, Imur: imur, Parts: parts, File: file})
+			if err != nil {
+				log.Printf("保存 %s 的上传进度出现错误：%v", file, err)
+				return
+			}
+			e = fmt.Errorf("%w：%v", errStopUpload, e)
+		}
+	}()
 	defer func() {
 		if err := recover(); err != nil {
 			e = fmt.Errorf("multipartUploadFile() error: %v", err)
@@ -68,31 +224,35 @@ func multipartUploadFile(ft *fastToken, file string, sp *saveProgress) (e error)
 
 	log.Println("断点续传模式上传文件：" + file)
 
-	// 存档文件保存在设置文件所在文件夹内
-	saveFile := filepath.Join(*saveDir, filepath.Base(file)+".json")
 	if sp != nil {
-		data, err := os.ReadFile(saveFile)
-		checkErr(err)
-		err = json.Unmarshal(data, sp)
+		s, err := readSaveFile(saveFile)
 		checkErr(err)
+		*sp = *s
 	}
 
-	var chunks []oss.FileChunk
-	var imur oss.InitiateMultipartUploadResult
-	var parts []oss.UploadPart
 	if sp != nil {
 		ft = sp.FastToken
+		// 恢复上传时从这次恢复的时间开始在 115 查找上传的文件
+		ft.Start = time.Now().Unix()
 		chunks = sp.Chunks
 		imur = sp.Imur
 		parts = sp.Parts
 	}
 
-	ot, bucket, err := getBucket(ft.Bucket)
+	cp, bucket, err := getBucket(ft.Bucket)
 	checkErr(err)
-	// ossToken 一小时后就会失效，所以每 50 分钟重新获取一次
-	ticker := time.NewTicker(50 * time.Minute)
-	defer ticker.Stop()
-
+	if sp != nil {
+		// 检查 upload ID 是否已经失效
+		_, err = bucket.ListUploadedParts(imur,
+			oss.UserAgentHeader(aliUserAgent),
+		)
+		if isOSSError(err, "NoSuchUpload") {
+			removeSaveFile(saveFile)
+			return errNoSuchUpload
+		} else if err != nil && *verbose {
+			log.Printf("获取 %s 已上传的分片出现错误：%v", file, err)
+		}
+	}
 	cb := base64.StdEncoding.EncodeToString([]byte(ft.Callback.Callback))
 	cbVar := base64.StdEncoding.EncodeToString([]byte(ft.Callback.CallbackVar))
 
@@ -108,36 +268,16 @@ func multipartUploadFile(ft *fastToken, file string, sp *saveProgress) (e error)
 			log.Printf("%s 的大小小于1KB，改用普通模式上传", file)
 			return ossUploadFile(ft, file)
 		}
-		// 上传的文件大小不能超过 115GB
-		if info.Size() > 115*1024*1024*1024 {
-			return fmt.Errorf("%s 的大小超过115GB，取消上传", file)
-		}
-		// 是否指定分片数量
-		if config.PartsNum != 0 {
-			chunks, err = oss.SplitFileByPartNum(file, int(config.PartsNum))
-			checkErr(err)
-		} else {
-			for i := int64(1); i < 10; i++ {
-				if info.Size() < i*1024*1024*1024 {
-					// 文件大小小于 iGB 时分为 i*1000 片
-					chunks, err = oss.SplitFileByPartNum(file, int(i*1000))
-					checkErr(err)
-					break
-				}
-			}
-			if info.Size() > 9*1024*1024*1024 {
-				// 文件大小大于 9GB 时分为 10000 片
-				chunks, err = oss.SplitFileByPartNum(file, maxParts)
-				checkErr(err)
-			}
-		}
-		// 单个分片大小不能小于 100KB
-		if chunks[0].Size < 100*1024 {
-			chunks, err = oss.SplitFileByPartSize(file, 100*1024)
-			checkErr(err)
+		// 上传的文件大小不能超过账号的上传限制
+		err = checkSizeLimit(file, info.Size())
+		checkErr(err)
+		chunks, err = splitFile(file, info.Size())
+		checkErr(err)
+		if len(ft.PartsMD5) != 0 && len(ft.PartsMD5) != len(chunks) {
+			log.Printf("%s 的分片数量和计算 md5 值时的不一致，不校验分片的 md5 值", file)
+			ft.PartsMD5 = nil
 		}
 		imur, err = bucket.InitiateMultipartUpload(ft.Object,
-			oss.SetHeader("x-oss-security-token", ot.SecurityToken),
 			oss.UserAgentHeader(aliUserAgent),
 			oss.Sequential(),
 		)
@@ -166,34 +306,29 @@ func multipartUploadFile(ft *fastToken, file string, sp *saveProgress) (e error)
 		select {
 		case <-multipartCh:
 			bar.Finish()
-			log.Printf("正在保存 %s 的上传进度，存档文件是 %s", file, saveFile)
-			sp = &saveProgress{FastToken: ft, Chunks: chunks, Imur: imur, Parts: parts}
-			data, err := json.Marshal(*sp)
+			err := saveUploadProgress(saveFile, &saveProgress{FastToken: ft, Chunks: chunks, Imur: imur, Parts: parts, File: file})
 			checkErr(err)
-			err = os.WriteFile(saveFile, data, 0644)
-			checkErr(err)
-			result.Saved = append(result.Saved, file)
 			multipartCh <- struct{}{}
 			return errStopUpload
 		default:
 			var part oss.UploadPart
 			// 出现错误就继续尝试，共尝试 3 次
+			options := []oss.Option{
+				oss.UserAgentHeader(aliUserAgent),
+				oss.Progress(&multipartProgressListener{}),
+			}
+			if len(ft.PartsMD5) == len(chunks) {
+				// 让 OSS 校验分片的数据和计算 hash 值时读取的数据是否一致
+				options = append(options, oss.ContentMD5(ft.PartsMD5[chunk.Number-1]))
+			}
 			for retry := 0; retry < 3; retry++ {
-				select {
-				case <-ticker.C:
-					// 到时重新获取 ossToken
-					ot, bucket, err = getBucket(ft.Bucket)
-					checkErr(err)
-				default:
-				}
 				f.Seek(chunk.Offset, io.SeekStart)
-				part, err = bucket.UploadPart(imur, f, chunk.Size, chunk.Number,
-					oss.SetHeader("x-oss-security-token", ot.SecurityToken),
-					oss.UserAgentHeader(aliUserAgent),
-					oss.Progress(&multipartProgressListener{}),
-				)
-				if err == nil {
+				part, err = bucket.UploadPart(imur, f, chunk.Size, chunk.Number, options...)
+				if err == nil || isOSSError(err, "NoSuchUpload") {
 					break
+				} else if isTokenExpired(err) {
+					log.Printf("上传 %s 的第%d个分片时 ossToken 已失效，重新获取 ossToken", file, chunk.Number)
+					cp.invalidate()
 				} else {
 					log.Printf("上传 %s 的第%d个分片时出现错误：%v", file, chunk.Number, err)
 					if retry != 2 {
@@ -201,16 +336,16 @@ func multipartUploadFile(ft *fastToken, file string, sp *saveProgress) (e error)
 					}
 				}
 			}
+			if isOSSError(err, "NoSuchUpload") {
+				bar.Finish()
+				removeSaveFile(saveFile)
+				return errNoSuchUpload
+			}
 			if err != nil {
 				bar.Finish()
 				// 分片上传出现 3 次错误则保存上传进度
-				log.Printf("正在保存 %s 的上传进度，存档文件是 %s", file, saveFile)
-				sp = &saveProgress{FastToken: ft, Chunks: chunks, Imur: imur, Parts: parts}
-				data, err := json.Marshal(*sp)
-				checkErr(err)
-				err = os.WriteFile(saveFile, data, 0644)
+				err := saveUploadProgress(saveFile, &saveProgress{FastToken: ft, Chunks: chunks, Imur: imur, Parts: parts, File: file})
 				checkErr(err)
-				result.Saved = append(result.Saved, file)
 				return errStopUpload
 			}
 			parts = append(parts, part)
@@ -219,61 +354,206 @@ func multipartUploadFile(ft *fastToken, file string, sp *saveProgress) (e error)
 	uploadingPart = false
 	bar.Finish()
 
-	select {
-	case <-ticker.C:
-		// 到时重新获取 ossToken
-		ot, bucket, err = getBucket(ft.Bucket)
-		checkErr(err)
-	default:
-	}
 	var header http.Header
-	cmur, err := bucket.CompleteMultipartUpload(imur, parts,
-		oss.SetHeader("x-oss-security-token", ot.SecurityToken),
+	options := []oss.Option{
 		oss.SetHeader("x-oss-hash-sha1", ft.SHA1),
 		oss.Callback(cb),
 		oss.CallbackVar(cbVar),
 		oss.UserAgentHeader(aliUserAgent),
 		oss.GetResponseHeader(&header),
-	)
+	}
+	cmur, err := bucket.CompleteMultipartUpload(imur, parts, options...)
+	if isTokenExpired(err) {
+		cp.invalidate()
+		cmur, err = bucket.CompleteMultipartUpload(imur, parts, options...)
+	}
+	if isOSSError(err, "NoSuchUpload") {
+		removeSaveFile(saveFile)
+		return errNoSuchUpload
+	}
+	completed = err == nil || errors.Is(err, io.EOF)
 	// EOF 错误是 xml 的 Unmarshal 导致的，响应其实是 json 格式，所以实际上上传是成功的
 	if err != nil && !errors.Is(err, io.EOF) {
-		// 当文件名含有 &< 这两个字符之一时响应的 xml 解析会出现错误，实际上上传是成功的
+		// 当文件名含有 &< 这两个字符之一时响应的 xml 解析会出现错误，实际上上传是成功的，
+		// 现在上传时会替换这两个字符，这里是为了兼容之前保存的存档文件
 		if filename := filepath.Base(file); !strings.ContainsAny(filename, "&<") {
 			panic(err)
 		}
+		completed = true
 	}
 	if *verbose {
 		log.Printf("CompleteMultipartUpload 的响应头的值是：\n%+v", header)
 		log.Printf("cmur 的值是：%+v", cmur)
 	}
+	err = checkCRC64(header, ft.CRC64)
+	checkErr(err)
 
 	time.Sleep(time.Second)
 	// 验证上传是否成功
-	fileURL := fmt.Sprintf(listFileURL, config.CID, 20)
-	v, err := getURLJSON(fileURL)
-	checkErr(err)
-	s := string(v.GetStringBytes("data", "0", "sha"))
-	if s == ft.SHA1 {
-		log.Printf("断点续传模式上传 %s 成功", file)
-		if sp != nil {
-			log.Printf("删除存档文件 %s", saveFile)
-			err = os.Remove(saveFile)
-			checkErr(err)
-		}
-		if *removeFile {
-			f.Close()
-			err = remove(file)
-			checkErr(err)
-		}
-	} else {
-		panic(fmt.Errorf("断点续传模式上传 %s 失败", file))
+	if err := verifyUpload(ft, file); err != nil {
+		panic(fmt.Errorf("断点续传模式上传 %s 失败：%w", file, err))
+	}
+	log.Printf("断点续传模式上传 %s 成功", file)
+	if sp != nil {
+		log.Printf("删除存档文件 %s", saveFile)
+		err = os.Remove(saveFile)
+		checkErr(err)
 	}
 
 	return nil
 }
 
+// 保存上传进度到存档文件
+func saveUploadProgress(saveFile string, sp *saveProgress) error {
+	log.Printf("正在保存 %s 的上传进度，存档文件是 %s", sp.File, saveFile)
+	data, err := json.Marshal(*sp)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(saveFile, data, 0644); err != nil {
+		return err
+	}
+	result.Saved = append(result.Saved, sp.File)
+	return nil
+}
+
 // 恢复上传文件
 func resumeUpload(file string) (e error) {
 	sp := new(saveProgress)
 	return multipartUploadFile(nil, file, sp)
 }
+
+// 删除存在的存档文件
+func removeSaveFile(saveFile string) {
+	if _, err := os.Stat(saveFile); err != nil {
+		return
+	}
+	log.Printf("删除存档文件 %s", saveFile)
+	if err := os.Remove(saveFile); err != nil {
+		log.Printf("删除存档文件 %s 出现错误：%v", saveFile, err)
+	}
+}
+
+// 取消 multipart 上传，upload ID 已失效时不返回错误
+func abortUpload(bucketName string, imur oss.InitiateMultipartUploadResult) error {
+	_, bucket, err := getBucket(bucketName)
+	if err != nil {
+		return err
+	}
+	err = bucket.AbortMultipartUpload(imur,
+		oss.UserAgentHeader(aliUserAgent),
+	)
+	if err != nil && !isOSSError(err, "NoSuchUpload") {
+		return fmt.Errorf("取消上传 %s 出现错误：%w", imur.Key, err)
+	}
+
+	return nil
+}
+
+// 判断存档文件里记录的上传是否已经失效
+func uploadExpired(sp *saveProgress) (bool, error) {
+	_, bucket, err := getBucket(sp.FastToken.Bucket)
+	if err != nil {
+		return false, err
+	}
+	_, err = bucket.ListUploadedParts(sp.Imur,
+		oss.UserAgentHeader(aliUserAgent),
+	)
+	if isOSSError(err, "NoSuchUpload") {
+		return true, nil
+	}
+	return false, err
+}
+
+// 选出原文件已经不存在或者上传已经失效的存档文件，跳过还可以继续上传的存档文件
+func orphanSaveFiles(saveFiles []string, expired func(sp *saveProgress) (bool, error)) []string {
+	var orphans []string
+	for _, saveFile := range saveFiles {
+		sp, err := readSaveFile(saveFile)
+		if err != nil {
+			log.Printf("读取存档文件 %s 出现错误：%v", saveFile, err)
+			continue
+		}
+		if _, err := os.Stat(sp.File); err != nil {
+			orphans = append(orphans, saveFile)
+			continue
+		}
+		ok, err := expired(sp)
+		if err != nil {
+			log.Printf("检查 %s 的上传是否失效出现错误，不清理存档文件 %s ：%v", sp.File, saveFile, err)
+			continue
+		}
+		if ok {
+			orphans = append(orphans, saveFile)
+			continue
+		}
+		log.Printf("跳过还可以继续上传的 %s ，需要取消上传时指定存档文件 %s 或者加上参数 -cleanup-all", sp.File, saveFile)
+	}
+	return orphans
+}
+
+// cleanup 子命令，取消存档文件里记录的上传并删除存档文件，
+// 不指定存档文件时只清理原文件已经不存在或者上传已经失效的存档文件，除非设置了 -cleanup-all
+func cleanupCommand(args []string) error {
+	saveFiles := args
+	if len(saveFiles) == 0 {
+		entries, err := os.ReadDir(*saveDir)
+		if err != nil {
+			return fmt.Errorf("读取文件夹 %s 出现错误：%w", *saveDir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+			saveFile := filepath.Join(*saveDir, entry.Name())
+			// 跳过设置文件等不是存档文件的 json 文件
+			if _, err := readSaveFile(saveFile); err != nil {
+				if *verbose {
+					log.Printf("跳过 %s ：%v", saveFile, err)
+				}
+				continue
+			}
+			saveFiles = append(saveFiles, saveFile)
+		}
+	}
+	if len(saveFiles) == 0 {
+		log.Printf("%s 里没有存档文件", *saveDir)
+		return nil
+	}
+	if len(args) == 0 && !*cleanupAll {
+		saveFiles = orphanSaveFiles(saveFiles, uploadExpired)
+		if len(saveFiles) == 0 {
+			log.Printf("%s 里没有需要清理的存档文件", *saveDir)
+			return nil
+		}
+	}
+
+	return cleanupSaveFiles(saveFiles, func(sp *saveProgress) error {
+		return abortUpload(sp.FastToken.Bucket, sp.Imur)
+	})
+}
+
+// 用 abort 取消存档文件里记录的上传，取消成功后删除存档文件
+func cleanupSaveFiles(saveFiles []string, abort func(sp *saveProgress) error) error {
+	failed := 0
+	for _, saveFile := range saveFiles {
+		sp, err := readSaveFile(saveFile)
+		if err == nil {
+			err = abort(sp)
+		}
+		if err != nil {
+			log.Printf("清理存档文件 %s 出现错误：%v", saveFile, err)
+			failed++
+			continue
+		}
+		if sp.File != "" {
+			log.Printf("已取消 %s 的上传", sp.File)
+		}
+		removeSaveFile(saveFile)
+	}
+	if failed != 0 {
+		return fmt.Errorf("有 %d 个存档文件清理失败", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// 写入存档文件
+func writeTestSaveFile(t *testing.T, file string, sp *saveProgress) {
+	t.Helper()
+	data, err := json.Marshal(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testSaveProgress(file string) *saveProgress {
+	return &saveProgress{
+		FastToken: &fastToken{Bucket: "bucket"},
+		Imur:      oss.InitiateMultipartUploadResult{Bucket: "bucket", Key: "key", UploadID: "id"},
+		File:      file,
+	}
+}
+
+func TestReadSaveFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "a.txt.json")
+	writeTestSaveFile(t, valid, testSaveProgress("a.txt"))
+	sp, err := readSaveFile(valid)
+	if err != nil {
+		t.Fatalf("readSaveFile() error: %v", err)
+	}
+	if sp.File != "a.txt" || sp.Imur.UploadID != "id" || sp.FastToken.Bucket != "bucket" {
+		t.Errorf("readSaveFile() result: %+v", sp)
+	}
+
+	noUpload := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(noUpload, []byte(`{"cookies":""}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{noUpload, invalid, filepath.Join(dir, "missing.json")} {
+		if _, err := readSaveFile(file); err == nil {
+			t.Errorf("readSaveFile(%s) should fail", file)
+		}
+	}
+}
+
+func TestCleanupCommand(t *testing.T) {
+	verbose = new(bool)
+	cleanupAll = new(bool)
+	dir := t.TempDir()
+	saveDir = &dir
+
+	// 只有设置文件时没有要清理的存档文件
+	cfgFile := filepath.Join(dir, "fake115uploader.json")
+	if err := os.WriteFile(cfgFile, []byte(`{"cookies":""}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupCommand(nil); err != nil {
+		t.Errorf("cleanupCommand() without save files error: %v", err)
+	}
+	if _, err := os.Stat(cfgFile); err != nil {
+		t.Errorf("config file should not be removed: %v", err)
+	}
+
+	if err := cleanupCommand([]string{cfgFile}); err == nil {
+		t.Error("cleanupCommand() with a file that is not a save file should fail")
+	}
+}
+
+func TestOrphanSaveFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.mp4")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saveFiles := make(map[string]string)
+	for _, name := range []string{"live", "gone", "expired", "error"} {
+		sp := testSaveProgress(source)
+		sp.Imur.UploadID = name
+		if name == "gone" {
+			sp.File = filepath.Join(dir, "missing.mp4")
+		}
+		saveFiles[name] = filepath.Join(dir, name+".json")
+		writeTestSaveFile(t, saveFiles[name], sp)
+	}
+
+	var checked []string
+	orphans := orphanSaveFiles([]string{saveFiles["live"], saveFiles["gone"], saveFiles["expired"], saveFiles["error"], filepath.Join(dir, "bad.json")},
+		func(sp *saveProgress) (bool, error) {
+			checked = append(checked, sp.Imur.UploadID)
+			switch sp.Imur.UploadID {
+			case "expired":
+				return true, nil
+			case "error":
+				return false, errors.New("network error")
+			}
+			return false, nil
+		})
+	if want := []string{saveFiles["gone"], saveFiles["expired"]}; !reflect.DeepEqual(orphans, want) {
+		t.Errorf("orphan save files want: %v, result: %v", want, orphans)
+	}
+	// 原文件不存在时不需要检查上传是否失效
+	if want := []string{"live", "expired", "error"}; !reflect.DeepEqual(checked, want) {
+		t.Errorf("checked uploads want: %v, result: %v", want, checked)
+	}
+}
+
+func TestCleanupSaveFiles(t *testing.T) {
+	dir := t.TempDir()
+	ok := filepath.Join(dir, "ok.json")
+	writeTestSaveFile(t, ok, testSaveProgress("ok"))
+	fail := filepath.Join(dir, "fail.json")
+	writeTestSaveFile(t, fail, testSaveProgress("fail"))
+	missing := filepath.Join(dir, "missing.json")
+
+	var aborted []string
+	err := cleanupSaveFiles([]string{ok, fail, missing}, func(sp *saveProgress) error {
+		aborted = append(aborted, sp.File)
+		if sp.File == "fail" {
+			return errors.New("network error")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Error("cleanupSaveFiles() should report failed save files")
+	}
+	if len(aborted) != 2 {
+		t.Errorf("aborted uploads want: [ok fail], result: %v", aborted)
+	}
+	if _, err := os.Stat(ok); !os.IsNotExist(err) {
+		t.Errorf("save file of aborted upload should be removed: %v", err)
+	}
+	if _, err := os.Stat(fail); err != nil {
+		t.Errorf("save file of failed abort should be kept: %v", err)
+	}
+}
+
+func TestRestartUpload(t *testing.T) {
+	verbose = new(bool)
+	dir := t.TempDir()
+	saveFile := filepath.Join(dir, "a.txt.json")
+	errOther := errors.New("other")
+
+	tests := []struct {
+		name     string
+		saveFile bool
+		resume   error
+		uploads  []error
+		want     error
+		resumes  int
+		attempts int
+	}{
+		{"resume ok", true, nil, nil, nil, 1, 0},
+		{"resume error", true, errOther, nil, errOther, 1, 0},
+		{"resume expired", true, errNoSuchUpload, []error{nil}, nil, 1, 1},
+		{"no save file", false, nil, []error{nil}, nil, 0, 1},
+		{"expired once", false, nil, []error{errNoSuchUpload, nil}, nil, 0, 2},
+		{"expired twice", false, nil, []error{errNoSuchUpload, errNoSuchUpload}, errNoSuchUpload, 0, 2},
+		{"resume and upload expired", true, errNoSuchUpload, []error{errNoSuchUpload, errOther}, errOther, 1, 2},
+	}
+	for _, tt := range tests {
+		os.Remove(saveFile)
+		if tt.saveFile {
+			writeTestSaveFile(t, saveFile, testSaveProgress("a.txt"))
+		}
+		resumes, attempts := 0, 0
+		err := restartUpload("a.txt", saveFile,
+			func() error {
+				resumes++
+				return tt.resume
+			},
+			func() error {
+				attempts++
+				return tt.uploads[attempts-1]
+			})
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: error want: %v, result: %v", tt.name, tt.want, err)
+		}
+		if resumes != tt.resumes || attempts != tt.attempts {
+			t.Errorf("%s: resumes want: %d, result: %d, uploads want: %d, result: %d",
+				tt.name, tt.resumes, resumes, tt.attempts, attempts)
+		}
+	}
+}
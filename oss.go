@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
@@ -33,6 +36,108 @@ type ossToken struct {
 	endpoint        string
 }
 
+// 实现 oss.Credentials 的接口
+func (ot *ossToken) GetAccessKeyID() string {
+	return ot.AccessKeyID
+}
+
+// 实现 oss.Credentials 的接口
+func (ot *ossToken) GetAccessKeySecret() string {
+	return ot.AccessKeySecret
+}
+
+// 实现 oss.Credentials 的接口
+func (ot *ossToken) GetSecurityToken() string {
+	return ot.SecurityToken
+}
+
+// ossToken 的过期时间，解析失败时按获取后 50 分钟过期计算
+func (ot *ossToken) expireTime(fetched time.Time) time.Time {
+	if t, err := time.Parse(time.RFC3339, ot.Expiration); err == nil {
+		return t
+	}
+	return fetched.Add(50 * time.Minute)
+}
+
+// 提前刷新 ossToken 的时间
+const tokenRefreshAhead = 5 * time.Minute
+
+// 根据 ossToken 的过期时间自动刷新的 OSS 凭证，实现 oss.CredentialsProviderE 的接口
+type ossCredentialsProvider struct {
+	mu     sync.Mutex
+	token  *ossToken
+	expire time.Time
+	fetch  func() (*ossToken, error) // 获取 ossToken
+}
+
+// 获取 ossToken 并新建 ossCredentialsProvider
+func newOSSCredentialsProvider() (*ossCredentialsProvider, error) {
+	cp := &ossCredentialsProvider{fetch: getOSSToken}
+	if err := cp.refresh(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// 重新获取 ossToken
+func (cp *ossCredentialsProvider) refresh() error {
+	now := time.Now()
+	ot, err := cp.fetch()
+	if err != nil {
+		return err
+	}
+	cp.token = ot
+	cp.expire = ot.expireTime(now)
+	if *verbose {
+		log.Printf("ossToken 的过期时间是：%s", cp.expire.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// 让 ossToken 失效，下次请求时重新获取
+func (cp *ossCredentialsProvider) invalidate() {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.expire = time.Time{}
+}
+
+// 在 now 时是否需要刷新 ossToken，在过期前 tokenRefreshAhead 就开始刷新
+func (cp *ossCredentialsProvider) needRefresh(now time.Time) bool {
+	return now.Add(tokenRefreshAhead).After(cp.expire)
+}
+
+// 实现 oss.CredentialsProviderE 的接口
+func (cp *ossCredentialsProvider) GetCredentialsE() (oss.Credentials, error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.needRefresh(time.Now()) {
+		if *verbose {
+			log.Println("ossToken 即将过期，重新获取 ossToken")
+		}
+		if err := cp.refresh(); err != nil {
+			return nil, fmt.Errorf("刷新 ossToken 出现错误：%w", err)
+		}
+	}
+	return cp.token, nil
+}
+
+// 实现 oss.CredentialsProvider 的接口
+func (cp *ossCredentialsProvider) GetCredentials() oss.Credentials {
+	c, err := cp.GetCredentialsE()
+	if err != nil {
+		log.Println(err)
+		cp.mu.Lock()
+		defer cp.mu.Unlock()
+		return cp.token
+	}
+	return c
+}
+
+// 判断是否 ossToken 失效导致的错误
+func isTokenExpired(err error) bool {
+	return isOSSError(err, "InvalidAccessKeyId", "SecurityTokenExpired")
+}
+
 // 进度监听
 type ossProgressListener struct{}
 
@@ -164,6 +269,32 @@ func getClientOptions() (options []oss.ClientOption) {
 	return options
 }
 
+// 以普通模式上传文件，较大的文件改用断点续传模式上传，中断上传时可以保存上传进度
+func (file *fileInfo) normalUploadFile() error {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return fmt.Errorf("获取文件 %s 的信息出现错误：%w", file.Path, err)
+	}
+	if err := checkSizeLimit(file.Path, info.Size()); err != nil {
+		return err
+	}
+	if _, err := os.Stat(saveFilePath(file.Path)); err == nil {
+		return file.multipartUpload()
+	}
+	if useMultipart(info.Size()) {
+		log.Printf("%s 的大小超过%s，改用断点续传模式上传", file.Path, formatSize(multipartThreshold()))
+		return file.multipartUpload()
+	}
+
+	token, err := file.fastUploadFile()
+	if err == nil {
+		return nil
+	}
+	log.Printf("秒传模式上传 %s 出现错误：%v", file.Path, err)
+	log.Printf("现在开始使用普通模式上传 %s", file.Path)
+	return ossUploadFile(token, file.Path)
+}
+
 // 利用 oss 的接口上传文件
 func ossUploadFile(ft *fastToken, file string) (e error) {
 	defer func() {
@@ -174,52 +305,78 @@ func ossUploadFile(ft *fastToken, file string) (e error) {
 
 	log.Println("普通模式上传文件：" + file)
 
-	ot, err := getOSSToken()
-	checkErr(err)
-	client, err := oss.New(ot.endpoint, ot.AccessKeyID, ot.AccessKeySecret, getClientOptions()...)
-	checkErr(err)
-	bucket, err := client.Bucket(ft.Bucket)
+	cp, bucket, err := getBucket(ft.Bucket)
 	checkErr(err)
 
 	cb := base64.StdEncoding.EncodeToString([]byte(ft.Callback.Callback))
 	cbVar := base64.StdEncoding.EncodeToString([]byte(ft.Callback.CallbackVar))
+	var header http.Header
 	options := []oss.Option{
-		oss.SetHeader("x-oss-security-token", ot.SecurityToken),
 		oss.Callback(cb),
 		oss.CallbackVar(cbVar),
 		oss.UserAgentHeader(aliUserAgent),
 		oss.Progress(&ossProgressListener{}),
+		oss.GetResponseHeader(&header),
 	}
 
 	fmt.Println("按 q 键停止上传并退出程序")
 	err = bucket.PutObjectFromFile(ft.Object, file, options...)
+	if isTokenExpired(err) {
+		// ossToken 失效的话重新获取再上传一次
+		log.Printf("ossToken 已失效，重新上传 %s", file)
+		cp.invalidate()
+		err = bucket.PutObjectFromFile(ft.Object, file, options...)
+	}
+	checkErr(err)
+	err = checkCRC64(header, ft.CRC64)
 	checkErr(err)
 
 	time.Sleep(time.Second)
 	// 验证上传是否成功
-	fileURL := fmt.Sprintf(listFileURL, config.CID, 20)
-	v, err := getURLJSON(fileURL)
-	checkErr(err)
-	s := string(v.GetStringBytes("data", "0", "sha"))
-	if s == ft.SHA1 {
-		log.Printf("普通模式上传 %s 成功", file)
-		if *removeFile {
-			err = remove(file)
-			checkErr(err)
-		}
-	} else {
-		panic(fmt.Errorf("普通模式上传 %s 失败", file))
+	if err := verifyUpload(ft, file); err != nil {
+		panic(fmt.Errorf("普通模式上传 %s 失败：%w", file, err))
 	}
+	log.Printf("普通模式上传 %s 成功", file)
 
 	return nil
 }
 
-// 删除文件
-func remove(file string) error {
-	err := os.Remove(file)
+// 判断是否 OSS 返回的指定错误码的错误
+func isOSSError(err error, codes ...string) bool {
+	var e oss.ServiceError
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, code := range codes {
+		if e.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 比较 OSS 返回的 crc64 值和计算 hash 值时得到的 crc64 值，crc 为 0 时不比较
+func checkCRC64(header http.Header, crc uint64) error {
+	if crc == 0 {
+		return nil
+	}
+	s := header.Get(oss.HTTPHeaderOssCRC64)
+	if s == "" {
+		if *verbose {
+			log.Println("OSS 的响应头里没有 crc64 值，不校验 crc64 值")
+		}
+		return nil
+	}
+	ossCRC, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		return fmt.Errorf("删除原文件 %s 出现错误：%w", file, err)
+		return fmt.Errorf("解析 OSS 返回的 crc64 值 %s 出现错误：%w", s, err)
+	}
+	if ossCRC != crc {
+		return fmt.Errorf("OSS 返回的 crc64 值 %d 和文件的 crc64 值 %d 不一致，文件可能在上传期间被修改过", ossCRC, crc)
+	}
+	if *verbose {
+		log.Printf("校验 crc64 值 %d 成功", crc)
 	}
-	log.Printf("成功删除原文件 %s", file)
 	return nil
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+func TestOSSTokenExpireTime(t *testing.T) {
+	fetched := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"2024-01-01T01:00:00Z": time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		"":                     fetched.Add(50 * time.Minute),
+		"invalid":              fetched.Add(50 * time.Minute),
+	}
+	for expiration, want := range tests {
+		ot := &ossToken{Expiration: expiration}
+		if result := ot.expireTime(fetched); !result.Equal(want) {
+			t.Errorf("expire time of %q want: %s, result: %s", expiration, want, result)
+		}
+	}
+}
+
+func TestOSSCredentialsProviderRefresh(t *testing.T) {
+	verbose = new(bool)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		expire time.Time
+		want   bool
+	}{
+		{"expired", now.Add(-time.Minute), true},
+		{"inside refresh window", now.Add(tokenRefreshAhead - time.Second), true},
+		{"outside refresh window", now.Add(tokenRefreshAhead + time.Minute), false},
+		{"long before expiration", now.Add(time.Hour), false},
+		{"invalidated", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		cp := &ossCredentialsProvider{expire: tt.expire}
+		if result := cp.needRefresh(now); result != tt.want {
+			t.Errorf("%s: need refresh want: %v, result: %v", tt.name, tt.want, result)
+		}
+	}
+
+	fetches := 0
+	var fetchErr error
+	cp := &ossCredentialsProvider{fetch: func() (*ossToken, error) {
+		fetches++
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return &ossToken{
+			AccessKeyID: fmt.Sprintf("id%d", fetches),
+			Expiration:  time.Now().Add(time.Hour).Format(time.RFC3339),
+		}, nil
+	}}
+	if err := cp.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := cp.GetCredentialsE(); err != nil || c.GetAccessKeyID() != "id1" || fetches != 1 {
+		t.Errorf("fresh token should not be refreshed, id: %s, fetches: %d, error: %v", c.GetAccessKeyID(), fetches, err)
+	}
+
+	cp.invalidate()
+	if c, err := cp.GetCredentialsE(); err != nil || c.GetAccessKeyID() != "id2" || fetches != 2 {
+		t.Errorf("invalidated token should be refreshed, fetches: %d, error: %v", fetches, err)
+	}
+
+	// 刷新失败时 GetCredentials 返回原来的 ossToken
+	cp.invalidate()
+	fetchErr = errors.New("network error")
+	if _, err := cp.GetCredentialsE(); err == nil {
+		t.Error("GetCredentialsE() should fail when refresh fails")
+	}
+	if c := cp.GetCredentials(); c.GetAccessKeyID() != "id2" {
+		t.Errorf("GetCredentials() should return the old token when refresh fails, result: %s", c.GetAccessKeyID())
+	}
+}
+
+func TestIsTokenExpired(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{oss.ServiceError{Code: "InvalidAccessKeyId"}, true},
+		{fmt.Errorf("wrapped: %w", oss.ServiceError{Code: "SecurityTokenExpired"}), true},
+		{oss.ServiceError{Code: "NoSuchUpload"}, false},
+		{errors.New("SecurityTokenExpired"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if result := isTokenExpired(tt.err); result != tt.want {
+			t.Errorf("isTokenExpired(%v) want: %v, result: %v", tt.err, tt.want, result)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// 预先计算的 hash 值
+type hashResult struct {
+	fh  *fileHash
+	err error
+}
+
+// 预先计算 hash 值的任务
+type hashJob struct {
+	file   *fileInfo
+	result chan<- hashResult
+	cancel <-chan struct{} // 关闭时不再计算
+	read   *atomic.Int64   // 已经读取的数据大小
+}
+
+// 没有用到的预先计算的 hash 值已被丢弃
+var errHashCanceled = errors.New("已取消预先计算 hash 值")
+
+var lookahead chan struct{} // 限制预先计算 hash 值的文件数量
+
+// 等待预先计算 hash 值时更新进度的间隔
+var hashWaitInterval = 200 * time.Millisecond
+
+// 上传时是否会用到文件的 hash 值，继续断点续传的文件和超过上传大小限制的文件不需要计算
+func (file *fileInfo) needHash() bool {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return false
+	}
+	switch file.mode() {
+	case modeNormal, modeMultipart:
+		if checkSizeLimit(file.Path, info.Size()) != nil {
+			return false
+		}
+		if _, err := os.Stat(saveFilePath(file.Path)); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// 在上传文件的同时预先计算之后的文件的 hash 值，第一个文件上传时直接计算并显示进度条
+func startHashPipeline(files []fileInfo) {
+	if config.HashLookahead == 0 || len(files) < 2 {
+		return
+	}
+	runHashPipeline(files[1:], config.HashLookahead, config.HashWorkers, func(file *fileInfo, read *atomic.Int64) (*fileHash, error) {
+		return file.computeHash(false, read)
+	})
+}
+
+// 用 workers 个 goroutine 按顺序计算文件的 hash 值，最多预先计算 ahead 个文件，
+// hash 计算文件的 hash 值并在 read 里记录已经读取的数据大小
+func runHashPipeline(files []fileInfo, ahead, workers uint, hash func(file *fileInfo, read *atomic.Int64) (*fileHash, error)) {
+	sem := make(chan struct{}, ahead)
+	lookahead = sem
+	var jobs []hashJob
+	for i := range files {
+		if !files[i].needHash() {
+			continue
+		}
+		result := make(chan hashResult, 1)
+		cancel := make(chan struct{})
+		read := new(atomic.Int64)
+		files[i].hashed, files[i].hashCancel, files[i].hashRead = result, cancel, read
+		jobs = append(jobs, hashJob{file: &files[i], result: result, cancel: cancel, read: read})
+	}
+
+	queue := make(chan hashJob)
+	go func() {
+		defer close(queue)
+		for _, job := range jobs {
+			sem <- struct{}{}
+			queue <- job
+		}
+	}()
+
+	for i := uint(0); i < workers; i++ {
+		go func() {
+			for job := range queue {
+				select {
+				case <-job.cancel:
+					job.result <- hashResult{err: errHashCanceled}
+					continue
+				default:
+				}
+				if *verbose {
+					log.Printf("预先计算 %s 的 hash 值", job.file.Path)
+				}
+				fh, err := hash(job.file, job.read)
+				job.result <- hashResult{fh: fh, err: err}
+			}
+		}()
+	}
+}
+
+// 获取文件的 hash 值，优先使用预先计算的 hash 值，还没计算完成时显示计算的进度
+func (file *fileInfo) getHash() (*fileHash, error) {
+	if file.hashed == nil {
+		return file.computeHash(true, nil)
+	}
+
+	var r hashResult
+	select {
+	case r = <-file.hashed:
+	default:
+		r = file.waitHash()
+	}
+	file.hashed, file.hashCancel, file.hashRead = nil, nil, nil
+	<-lookahead
+	return r.fh, r.err
+}
+
+// 等待正在预先计算的 hash 值，较大的文件显示进度条
+func (file *fileInfo) waitHash() hashResult {
+	if *verbose {
+		log.Printf("等待预先计算 %s 的 hash 值", file.Path)
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil || info.Size() < hashBarSize {
+		return <-file.hashed
+	}
+	bar := pb.New64(info.Size()).SetTemplate(pb.Full).Set(pb.Bytes, true).Set("prefix", "计算 hash 值").Start()
+	defer bar.Finish()
+	return waitHashResult(file.hashed, file.hashRead, func(n int64) { bar.SetCurrent(n) })
+}
+
+// 等待 result 返回 hash 值，期间定时用 report 报告已经读取的数据大小
+func waitHashResult(result <-chan hashResult, read *atomic.Int64, report func(n int64)) hashResult {
+	ticker := time.NewTicker(hashWaitInterval)
+	defer ticker.Stop()
+	for {
+		report(read.Load())
+		select {
+		case r := <-result:
+			report(read.Load())
+			return r
+		case <-ticker.C:
+		}
+	}
+}
+
+// 丢弃没有用到的预先计算的 hash 值，还没开始计算时不再计算，不等待正在进行的计算
+func (file *fileInfo) discardHash() {
+	if file.hashed != nil {
+		close(file.hashCancel)
+		file.hashed, file.hashCancel, file.hashRead = nil, nil, nil
+		<-lookahead
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 新建要上传的测试文件
+func pipelineFiles(t *testing.T, names ...string) []fileInfo {
+	t.Helper()
+	dir := t.TempDir()
+	files := make([]fileInfo, len(names))
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files[i] = fileInfo{Path: path, Mode: modeFast}
+	}
+	return files
+}
+
+// 记录计算过 hash 值的文件
+type hashRecorder struct {
+	mu     sync.Mutex
+	hashed []string
+}
+
+func (hr *hashRecorder) hash(file *fileInfo, read *atomic.Int64) (*fileHash, error) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	hr.hashed = append(hr.hashed, filepath.Base(file.Path))
+	return &fileHash{TotalHash: file.Path}, nil
+}
+
+func (hr *hashRecorder) count() int {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+	return len(hr.hashed)
+}
+
+func TestHashPipelineOrder(t *testing.T) {
+	verbose = new(bool)
+	files := pipelineFiles(t, "a", "b", "c", "d", "e")
+	hr := new(hashRecorder)
+	runHashPipeline(files, 2, 3, hr.hash)
+
+	for i := range files {
+		fh, err := files[i].getHash()
+		if err != nil {
+			t.Fatalf("getHash() error: %v", err)
+		}
+		if fh.TotalHash != files[i].Path {
+			t.Errorf("hash of %s want: %s, result: %s", files[i].Path, files[i].Path, fh.TotalHash)
+		}
+		if files[i].hashed != nil {
+			t.Errorf("hashed channel of %s should be reset", files[i].Path)
+		}
+	}
+}
+
+func TestHashPipelineLookahead(t *testing.T) {
+	verbose = new(bool)
+	files := pipelineFiles(t, "a", "b", "c", "d")
+	hr := new(hashRecorder)
+	runHashPipeline(files, 2, 4, hr.hash)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for hr.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := hr.count(); n != 2 {
+		t.Fatalf("hashed files before upload want: 2, result: %d", n)
+	}
+
+	if _, err := files[0].getHash(); err != nil {
+		t.Fatal(err)
+	}
+	for hr.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := hr.count(); n != 3 {
+		t.Errorf("hashed files after one upload want: 3, result: %d", n)
+	}
+}
+
+func TestHashPipelineDiscard(t *testing.T) {
+	verbose = new(bool)
+	dir := t.TempDir()
+	saveDir = &dir
+	files := pipelineFiles(t, "a", "b", "c", "resumed")
+	// 继续断点续传的文件不需要计算 hash 值
+	files[3].Mode = modeMultipart
+	if err := os.WriteFile(saveFilePath(files[3].Path), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hr := new(hashRecorder)
+	release := make(chan struct{})
+	runHashPipeline(files, 2, 1, func(file *fileInfo, read *atomic.Int64) (*fileHash, error) {
+		if filepath.Base(file.Path) == "a" {
+			<-release
+		}
+		return hr.hash(file, read)
+	})
+	if files[3].hashed != nil {
+		t.Error("resumed file should not be hashed in advance")
+	}
+
+	// 唯一的 worker 还在计算 a 时丢弃 b 的 hash 值
+	files[1].discardHash()
+	close(release)
+	if _, err := files[0].getHash(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files[2].getHash(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range hr.hashed {
+		if name == "b" || name == "resumed" {
+			t.Errorf("%s should not be hashed, hashed files: %v", name, hr.hashed)
+		}
+	}
+}
+
+func TestStartHashPipelineSkipsFirst(t *testing.T) {
+	verbose = new(bool)
+	checkHash = new(bool)
+	defer func(c uploadConfig) { config = c }(config)
+	config.HashLookahead, config.HashWorkers = 2, 1
+	files := pipelineFiles(t, "a", "b", "c")
+	startHashPipeline(files)
+
+	// 第一个文件上传时直接计算 hash 值并显示进度条
+	if files[0].hashed != nil {
+		t.Error("first file should not be hashed in advance")
+	}
+	for i := range files {
+		if i > 0 && (files[i].hashed == nil || files[i].hashRead == nil) {
+			t.Errorf("%s should be hashed in advance", files[i].Path)
+		}
+		if _, err := files[i].getHash(); err != nil {
+			t.Fatalf("getHash() error: %v", err)
+		}
+	}
+}
+
+func TestWaitHashResult(t *testing.T) {
+	defer func(d time.Duration) { hashWaitInterval = d }(hashWaitInterval)
+	hashWaitInterval = time.Millisecond
+
+	var mu sync.Mutex
+	var reported []int64
+	last := func() int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(reported) == 0 {
+			return -1
+		}
+		return reported[len(reported)-1]
+	}
+
+	result := make(chan hashResult, 1)
+	read := new(atomic.Int64)
+	done := make(chan hashResult)
+	go func() {
+		done <- waitHashResult(result, read, func(n int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, n)
+		})
+	}()
+
+	// 还在计算 hash 值时报告已经读取的数据大小
+	read.Store(50)
+	deadline := time.Now().Add(5 * time.Second)
+	for last() != 50 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := last(); n != 50 {
+		t.Fatalf("reported progress while waiting want: 50, result: %d", n)
+	}
+
+	read.Store(100)
+	result <- hashResult{fh: &fileHash{TotalHash: "HASH"}}
+	r := <-done
+	if r.fh == nil || r.fh.TotalHash != "HASH" {
+		t.Errorf("hash result want: HASH, result: %+v", r)
+	}
+	if n := last(); n != 100 {
+		t.Errorf("reported progress after hashing want: 100, result: %d", n)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// 上传计划里的文件
+type planEntry struct {
+	fileInfo
+	Size       int64 `json:"size"`                 // 文件大小
+	DirPending bool  `json:"dirPending,omitempty"` // 要上传到的文件夹还没在 115 创建
+}
+
+// 上传计划
+type uploadPlan struct {
+	Created   time.Time   `json:"created"`   // 生成计划的时间
+	RootCID   uint64      `json:"rootCID"`   // 要上传到的 115 文件夹的 cid
+	TotalSize int64       `json:"totalSize"` // 文件的总大小
+	Files     []planEntry `json:"files"`     // 要上传的文件
+}
+
+// 生成上传计划
+func newUploadPlan(files []fileInfo) *uploadPlan {
+	plan := &uploadPlan{
+		Created: time.Now(),
+		RootCID: config.CID,
+		Files:   make([]planEntry, 0, len(files)),
+	}
+	for _, file := range files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			skipped(file.Path, fmt.Sprintf("获取文件信息出现错误：%v", err))
+			continue
+		}
+		file.Mode = file.mode()
+		file.Name = file.remoteName(info)
+		plan.Files = append(plan.Files, planEntry{
+			fileInfo:   file,
+			Size:       info.Size(),
+			DirPending: file.dirPending,
+		})
+		plan.TotalSize += info.Size()
+	}
+
+	return plan
+}
+
+// 描述文件会使用的上传方式，upload 为需要上传数据时为 true
+func (entry *planEntry) describe() (desc string, upload bool) {
+	switch entry.Mode {
+	case modeFast:
+		return "秒传", false
+	case modeNormal:
+		if limit := uploadSizeLimit(); entry.Size > limit {
+			return fmt.Sprintf("超过%s，取消上传", formatSize(limit)), false
+		}
+		if _, err := os.Stat(saveFilePath(entry.Path)); err == nil {
+			return "断点续传（继续上传）", true
+		}
+		if useMultipart(entry.Size) {
+			return "秒传，失败后断点续传", true
+		}
+		return "秒传，失败后普通上传", true
+	case modeMultipart:
+		if _, err := os.Stat(saveFilePath(entry.Path)); err == nil {
+			return "断点续传（继续上传）", true
+		}
+		if entry.Size > 1024 {
+			return "秒传，失败后断点续传", true
+		}
+		return "秒传，失败后普通上传", true
+	default:
+		return "没有指定上传模式", false
+	}
+}
+
+// 打印上传计划
+func (plan *uploadPlan) print(bandwidth int64) {
+	var uploadSize int64
+	for i := range plan.Files {
+		entry := &plan.Files[i]
+		desc, upload := entry.describe()
+		if upload {
+			uploadSize += entry.Size
+		}
+		dir := entry.RemoteDir
+		if !strings.HasPrefix(dir, "/") {
+			dir = "/" + dir
+		}
+		cid := "新建文件夹"
+		if !entry.DirPending {
+			cid = fmt.Sprintf("cid：%d", entry.ParentID)
+		}
+		fmt.Printf("%10s  %s  %s  %s\n", formatSize(entry.Size), desc, path.Join(dir, entry.Name)+"（"+cid+"）", entry.Path)
+	}
+
+	if len(result.Skipped) != 0 {
+		fmt.Printf("跳过的文件（%d）：\n", len(result.Skipped))
+		for _, s := range result.Skipped {
+			fmt.Println(s)
+		}
+	}
+
+	fmt.Printf("要上传的文件（%d）：总大小 %s，秒传失败时需要上传 %s\n", len(plan.Files), formatSize(plan.TotalSize), formatSize(uploadSize))
+	if bandwidth > 0 {
+		d := time.Duration(float64(uploadSize) / float64(bandwidth) * float64(time.Second))
+		fmt.Printf("按照 %s/s 的上传速度，最多需要 %s\n", formatSize(bandwidth), d.Round(time.Second))
+	}
+}
+
+// 保存上传计划
+func (plan *uploadPlan) save(file string) error {
+	data, err := json.MarshalIndent(plan, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// 读取上传计划，在 115 创建还没创建的文件夹，返回要上传的文件
+func loadUploadPlan(file string) (files []fileInfo, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("loadUploadPlan() error: %v", err)
+		}
+	}()
+
+	data, err := os.ReadFile(file)
+	checkErr(err)
+	plan := new(uploadPlan)
+	err = json.Unmarshal(data, plan)
+	checkErr(err)
+	log.Printf("执行 %s 生成的上传计划，共 %d 个文件", plan.Created.Format("2006-01-02 15:04:05"), len(plan.Files))
+
+	dirs := newRemoteDirs(plan.RootCID)
+	files = make([]fileInfo, 0, len(plan.Files))
+	for _, entry := range plan.Files {
+		file := entry.fileInfo
+		if file.Mode == "" {
+			log.Printf("上传计划里的 %s 没有指定上传模式", file.Path)
+			result.Failed = append(result.Failed, file.Path)
+			continue
+		}
+		// 缓存里的文件夹可能已经被删除，所以每个文件夹都重新确认一次
+		if file.RemoteDir != "" {
+			pid, err := dirs.create(file.RemoteDir)
+			if err != nil {
+				log.Printf("创建文件夹 %s 出现错误，取消上传 %s ：%v", file.RemoteDir, file.Path, err)
+				result.Failed = append(result.Failed, file.Path)
+				continue
+			}
+			file.ParentID = pid
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadPlanRoundTrip(t *testing.T) {
+	verbose = new(bool)
+	dir := t.TempDir()
+	saveDir = &dir
+	defer func(r resultData) { result = r }(result)
+	result = resultData{}
+
+	small := filepath.Join(dir, "small.txt")
+	if err := os.WriteFile(small, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	files := []fileInfo{
+		{Path: small, ParentID: 10, Mode: modeNormal, Rel: "dir/small.txt"},
+		{Path: missing, ParentID: 10, Mode: modeFast},
+	}
+	plan := newUploadPlan(files)
+	if len(plan.Files) != 1 || plan.TotalSize != 4 || len(result.Skipped) != 1 {
+		t.Fatalf("plan files: %d, total size: %d, skipped: %v", len(plan.Files), plan.TotalSize, result.Skipped)
+	}
+
+	planFile := filepath.Join(dir, "plan.json")
+	if err := plan.save(planFile); err != nil {
+		t.Fatalf("save plan error: %v", err)
+	}
+	loaded, err := loadUploadPlan(planFile)
+	if err != nil {
+		t.Fatalf("load plan error: %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("loaded files want: 1, result: %d", len(loaded))
+	}
+	want := fileInfo{Path: small, ParentID: 10, Mode: modeNormal, Name: "small.txt", Rel: "dir/small.txt"}
+	got := loaded[0]
+	if got.Path != want.Path || got.ParentID != want.ParentID || got.Mode != want.Mode || got.Name != want.Name || got.Rel != want.Rel {
+		t.Errorf("loaded file want: %+v, result: %+v", want, got)
+	}
+}
+
+func TestPlanEntryDescribe(t *testing.T) {
+	dir := t.TempDir()
+	saveDir = &dir
+	defer func(size uint64) { config.MultipartSize = size }(config.MultipartSize)
+	config.MultipartSize = 100
+
+	resumed := filepath.Join(dir, "resumed.mp4")
+	if err := os.WriteFile(saveFilePath(resumed), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		entry  planEntry
+		upload bool
+		desc   string
+	}{
+		{planEntry{fileInfo: fileInfo{Mode: modeFast}, Size: 1 << 30}, false, "秒传"},
+		{planEntry{fileInfo: fileInfo{Mode: modeNormal, Path: "a"}, Size: 1024}, true, "秒传，失败后普通上传"},
+		{planEntry{fileInfo: fileInfo{Mode: modeNormal, Path: "a"}, Size: 200 << 20}, true, "秒传，失败后断点续传"},
+		{planEntry{fileInfo: fileInfo{Mode: modeNormal, Path: resumed}, Size: 200 << 20}, true, "断点续传（继续上传）"},
+		{planEntry{fileInfo: fileInfo{Mode: modeMultipart, Path: "a"}, Size: 512}, true, "秒传，失败后普通上传"},
+		{planEntry{fileInfo: fileInfo{Path: "a"}, Size: 512}, false, "没有指定上传模式"},
+	}
+	for _, tt := range tests {
+		desc, upload := tt.entry.describe()
+		if desc != tt.desc || upload != tt.upload {
+			t.Errorf("describe %+v want: %s %v, result: %s %v", tt.entry, tt.desc, tt.upload, desc, upload)
+		}
+	}
+}
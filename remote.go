@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// 115 网盘里的文件
+type remoteFile struct {
+	FID      string `json:"fid"`            // 文件的 id
+	PickCode string `json:"pickcode"`       // 文件的提取码
+	Name     string `json:"name"`           // 文件名
+	Size     int64  `json:"size"`           // 文件大小
+	SHA1     string `json:"sha1"`           // 文件的 sha1 hash 值
+	Time     int64  `json:"time"`           // 文件的上传时间（秒）
+	Path     string `json:"path,omitempty"` // 递归列出文件时文件的路径
+	CID      uint64 `json:"cid,omitempty"`  // 递归列出文件时文件所在的文件夹的 cid
+}
+
+// 获取 json 里的整数，兼容字符串格式的整数
+func jsonInt64(v *fastjson.Value, key string) int64 {
+	if s := v.GetStringBytes(key); s != nil {
+		n, _ := strconv.ParseInt(string(s), 10, 64)
+		return n
+	}
+	return v.GetInt64(key)
+}
+
+// 按上传时间降序列出 115 网盘 cid 文件夹里最新的 limit 个文件，同时返回文件夹里的文件总数
+func listRemoteFiles(cid uint64, limit int) ([]remoteFile, int, error) {
+	v, err := getURLJSON(fmt.Sprintf(listFileURL, cid, limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	if !v.GetBool("state") {
+		return nil, 0, fmt.Errorf("获取文件夹 %d 的文件列表失败：%s", cid, v.GetStringBytes("error"))
+	}
+
+	list := v.GetArray("data")
+	files := make([]remoteFile, 0, len(list))
+	for _, v := range list {
+		if v.Exists("fid") {
+			files = append(files, parseRemoteFile(v))
+		}
+	}
+
+	return files, int(jsonInt64(v, "count")), nil
+}
+
+// 解析文件列表里的文件
+func parseRemoteFile(v *fastjson.Value) remoteFile {
+	return remoteFile{
+		FID:      string(v.GetStringBytes("fid")),
+		PickCode: string(v.GetStringBytes("pc")),
+		Name:     string(v.GetStringBytes("n")),
+		Size:     jsonInt64(v, "s"),
+		SHA1:     string(v.GetStringBytes("sha")),
+		Time:     max(jsonInt64(v, "tp"), jsonInt64(v, "te")),
+	}
+}
+
+// 查找上传的文件时最多列出的文件数
+const findRemoteLimit = 100
+
+// 允许 115 记录的上传时间比本机开始上传的时间早的秒数，避免两边的时钟有偏差时找不到刚上传的文件
+const uploadTimeSlack = 60
+
+// 要在 115 网盘里查找的上传的文件
+type uploadMatch struct {
+	Name  string // 上传后的文件名，为空时不比较文件名
+	SHA1  string // 文件的 sha1 值
+	Size  int64  // 文件大小
+	Start int64  // 开始上传的时间（秒），为 0 时不比较上传时间
+}
+
+// 判断 115 网盘里的文件是否这次上传的文件
+func (m uploadMatch) match(rf remoteFile) bool {
+	if !strings.EqualFold(rf.SHA1, m.SHA1) || rf.Size != m.Size {
+		return false
+	}
+	if m.Name != "" && rf.Name != m.Name {
+		return false
+	}
+	return m.Start == 0 || rf.Time >= m.Start-uploadTimeSlack
+}
+
+// 在 115 网盘 cid 文件夹里最近上传的文件中查找这次上传的文件，没有找到时返回 nil，
+// 文件夹里的文件太多而没能全部检查时返回错误
+func findRemoteFile(cid uint64, m uploadMatch) (*remoteFile, error) {
+	files, count, err := listRemoteFiles(cid, findRemoteLimit)
+	if err != nil {
+		return nil, err
+	}
+	return matchRemoteFile(cid, files, count, m)
+}
+
+// 在列出的文件里查找这次上传的文件，count 是文件夹里的文件总数
+func matchRemoteFile(cid uint64, files []remoteFile, count int, m uploadMatch) (*remoteFile, error) {
+	for i := range files {
+		if m.match(files[i]) {
+			return &files[i], nil
+		}
+	}
+	if count > len(files) {
+		return nil, fmt.Errorf("115 的文件夹 %d 里有 %d 个文件，最近上传的 %d 个文件里没有找到 %s", cid, count, len(files), m.Name)
+	}
+
+	return nil, nil
+}
+
+// 在 115 网盘要上传到的文件夹里查找上传的文件，没有找到时返回 nil
+func (file *fileInfo) findRemote(info os.FileInfo) (*remoteFile, error) {
+	if file.remote != nil {
+		return file.remote, nil
+	}
+	if file.sha1 == "" {
+		// 断点续传时没有计算 hash 值
+		fh, err := file.computeHash(false, nil)
+		if err != nil {
+			return nil, err
+		}
+		file.sha1 = fh.TotalHash
+	}
+
+	name := file.name
+	if name == "" {
+		name = file.remoteName(info)
+	}
+	rf, err := findRemoteFile(file.ParentID, uploadMatch{Name: name, SHA1: file.sha1, Size: info.Size(), Start: file.start})
+	if err != nil {
+		return nil, err
+	}
+	file.remote = rf
+	return rf, nil
+}
+
+// 验证文件是否已经上传到 115 网盘的 cid 文件夹
+func verifyUpload(ft *fastToken, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	cid := ft.targetCID()
+	rf, err := findRemoteFile(cid, uploadMatch{Name: ft.Name, SHA1: ft.SHA1, Size: info.Size(), Start: ft.Start})
+	if err != nil {
+		return err
+	}
+	if rf == nil {
+		return fmt.Errorf("115 的文件夹 %d 里没有找到 %s", cid, file)
+	}
+	return nil
+}
+
+// 115 网盘里的文件夹
+type remoteDir struct {
+	CID  uint64 // 文件夹的 cid
+	Name string // 文件夹名
+}
+
+// 列出 115 网盘 cid 文件夹里的文件夹
+func listRemoteDirs(cid uint64) ([]remoteDir, error) {
+	dirs, _, err := listRemote(cid)
+	return dirs, err
+}
+
+// 列出 115 网盘 cid 文件夹里的文件夹和文件
+func listRemote(cid uint64) (dirs []remoteDir, files []remoteFile, e error) {
+	v, err := getURLJSON(fmt.Sprintf(listFileDirURL, cid))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !v.GetBool("state") {
+		return nil, nil, fmt.Errorf("获取文件夹 %d 的文件列表失败：%s", cid, v.GetStringBytes("error"))
+	}
+
+	for _, v := range v.GetArray("data") {
+		if v.Exists("fid") {
+			files = append(files, parseRemoteFile(v))
+			continue
+		}
+		id, err := strconv.ParseUint(string(v.GetStringBytes("cid")), 10, 64)
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, remoteDir{CID: id, Name: string(v.GetStringBytes("n"))})
+	}
+
+	return dirs, files, nil
+}
+
+// 递归列出 115 网盘 cid 文件夹里的所有文件，fn 的参数 dir 是文件所在的文件夹相对 cid 文件夹的路径
+func walkRemote(cid uint64, fn func(dir string, pid uint64, file remoteFile)) error {
+	return walkRemoteDir(cid, "", fn)
+}
+
+func walkRemoteDir(cid uint64, dir string, fn func(dir string, pid uint64, file remoteFile)) error {
+	// 等待一秒，避免请求太频繁
+	time.Sleep(time.Second)
+	dirs, files, err := listRemote(cid)
+	if err != nil {
+		return fmt.Errorf("列出文件夹 /%s 出现错误：%w", dir, err)
+	}
+	for _, file := range files {
+		file.Path = path.Join(dir, file.Name)
+		file.CID = cid
+		fn(dir, cid, file)
+	}
+	for _, d := range dirs {
+		if err := walkRemoteDir(d.CID, path.Join(dir, d.Name), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 参数里 115 网盘的文件或文件夹的 id 的前缀，例如 id:123，没有前缀的参数都是路径，避免把数字名字的文件夹当成 id
+const remoteIDPrefix = "id:"
+
+// 解析以 id: 开头的 115 网盘的文件或文件夹的 id，ok 为 false 时 s 是路径
+func parseRemoteID(s string) (id uint64, ok bool, e error) {
+	rest, ok := strings.CutPrefix(s, remoteIDPrefix)
+	if !ok {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseUint(rest, 10, 64)
+	if err != nil {
+		return 0, true, fmt.Errorf("%s 不是正确的 id", s)
+	}
+	return id, true, nil
+}
+
+// 解析 115 网盘的 cid（以 id: 开头）或者文件夹路径，以 / 开头的路径从根目录开始，否则从 -c 指定的文件夹开始，不会创建文件夹
+func resolveRemoteDir(s string) (uint64, error) {
+	if cid, ok, err := parseRemoteID(s); ok {
+		return cid, err
+	}
+
+	cid := config.CID
+	if strings.HasPrefix(s, "/") {
+		cid = 0
+	}
+	for _, name := range strings.Split(strings.Trim(path.Clean(s), "/"), "/") {
+		if name == "" || name == "." {
+			continue
+		}
+		dirs, err := listRemoteDirs(cid)
+		if err != nil {
+			return 0, err
+		}
+		found := false
+		for _, d := range dirs {
+			if d.Name == name {
+				cid, found = d.CID, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("115 里没有文件夹 %s", s)
+		}
+	}
+	return cid, nil
+}
+
+// 批量修改 115 网盘里的文件或文件夹，ids 是文件的 id 或者文件夹的 cid
+func postIDs(reqURL string, form url.Values, ids []string) error {
+	for i, id := range ids {
+		form.Set(fmt.Sprintf("fid[%d]", i), id)
+	}
+	v, err := postFormJSON(reqURL, form.Encode())
+	if err != nil {
+		return err
+	}
+	if !v.GetBool("state") {
+		return fmt.Errorf("操作失败：%s", v.GetStringBytes("error"))
+	}
+	return nil
+}
+
+// 将 115 网盘里的文件或文件夹移动到 cid 文件夹
+func moveRemote(cid uint64, ids ...string) error {
+	form := url.Values{}
+	form.Set("pid", strconv.FormatUint(cid, 10))
+	return postIDs(moveURL, form, ids)
+}
+
+// 删除 115 网盘 pid 文件夹里的文件或文件夹，ids 是文件的 id 或者文件夹的 cid
+func deleteRemote(pid uint64, ids ...string) error {
+	form := url.Values{}
+	form.Set("pid", strconv.FormatUint(pid, 10))
+	form.Set("ignore_warn", "1")
+	return postIDs(deleteURL, form, ids)
+}
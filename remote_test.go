@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMatchRemoteFile(t *testing.T) {
+	m := uploadMatch{Name: "a.jpg", SHA1: "ABCDEF", Size: 10, Start: 1000}
+	tests := []struct {
+		name  string
+		files []remoteFile
+		count int
+		want  string
+		err   bool
+	}{
+		{"match", []remoteFile{{FID: "1", Name: "a.jpg", SHA1: "abcdef", Size: 10, Time: 1001}}, 1, "1", false},
+		{"clock skew", []remoteFile{{FID: "1", Name: "a.jpg", SHA1: "abcdef", Size: 10, Time: 1000 - uploadTimeSlack}}, 1, "1", false},
+		{"old copy", []remoteFile{{FID: "1", Name: "a.jpg", SHA1: "abcdef", Size: 10, Time: 500}}, 1, "", false},
+		{"other name", []remoteFile{{FID: "1", Name: "b.jpg", SHA1: "abcdef", Size: 10, Time: 1001}}, 1, "", false},
+		{"other size", []remoteFile{{FID: "1", Name: "a.jpg", SHA1: "abcdef", Size: 11, Time: 1001}}, 1, "", false},
+		{"second", []remoteFile{
+			{FID: "1", Name: "a.jpg", SHA1: "abcdef", Size: 10, Time: 500},
+			{FID: "2", Name: "a.jpg", SHA1: "abcdef", Size: 10, Time: 1002},
+		}, 2, "2", false},
+		{"too many", []remoteFile{{FID: "1", Name: "b.jpg", SHA1: "abcdef", Size: 10, Time: 1001}}, 150, "", true},
+		{"too many but found", []remoteFile{{FID: "1", Name: "a.jpg", SHA1: "abcdef", Size: 10, Time: 1001}}, 150, "1", false},
+	}
+	for _, tt := range tests {
+		rf, err := matchRemoteFile(1, tt.files, tt.count, m)
+		if (err != nil) != tt.err {
+			t.Errorf("%s want error: %v, result: %v", tt.name, tt.err, err)
+		}
+		fid := ""
+		if rf != nil {
+			fid = rf.FID
+		}
+		if fid != tt.want {
+			t.Errorf("%s want fid: %q, result: %q", tt.name, tt.want, fid)
+		}
+	}
+
+	// 旧版本的存档文件没有记录文件名和开始上传的时间
+	rf, err := matchRemoteFile(1, []remoteFile{{FID: "1", Name: "b.jpg", SHA1: "abcdef", Size: 10, Time: 1}}, 1,
+		uploadMatch{SHA1: "abcdef", Size: 10})
+	if err != nil || rf == nil {
+		t.Errorf("match without name and start want found, result: %v %v", rf, err)
+	}
+}
+
+// 模拟 115 列出文件夹的接口，dirs 是每个文件夹的 cid 对应的文件夹列表的 json
+func fakeListClient(dirs map[string]string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, ok := dirs[req.URL.Query().Get("cid")]
+		if !ok {
+			data = "[]"
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader(`{"state":true,"data":` + data + `}`)),
+			Request:    req,
+		}, nil
+	})}
+}
+
+func TestResolveRemoteDir(t *testing.T) {
+	defer func(c *http.Client, cfg uploadConfig) { httpClient, config = c, cfg }(httpClient, config)
+	config = uploadConfig{CID: 7}
+	httpClient = fakeListClient(map[string]string{
+		"0": `[{"cid":"100","n":"2024"}]`,
+		"7": `[{"cid":"555","n":"2024"},{"cid":"556","n":"sub"}]`,
+	})
+
+	tests := []struct {
+		s    string
+		want uint64
+		err  bool
+	}{
+		// 数字名字的文件夹按照路径查找，不当成 cid
+		{"2024", 555, false},
+		{"/2024", 100, false},
+		{"id:2024", 2024, false},
+		{"id:0", 0, false},
+		{".", 7, false},
+		{"/", 0, false},
+		{"2025", 0, true},
+		{"id:abc", 0, true},
+	}
+	for _, tt := range tests {
+		cid, err := resolveRemoteDir(tt.s)
+		if (err != nil) != tt.err || cid != tt.want {
+			t.Errorf("resolve %q want: %d (error %v), result: %d, error: %v", tt.s, tt.want, tt.err, cid, err)
+		}
+	}
+}
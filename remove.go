@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 删除原文件的记录
+type removeRecord struct {
+	Time   time.Time `json:"time"`         // 删除的时间
+	Path   string    `json:"path"`         // 原文件的路径
+	Action string    `json:"action"`       // 删除或者移动
+	To     string    `json:"to,omitempty"` // 移动到的路径
+	Size   int64     `json:"size"`         // 文件大小
+	SHA1   string    `json:"sha1"`         // 文件的 sha1 值
+	CID    uint64    `json:"cid"`          // 文件在 115 所在的文件夹的 cid
+	FID    string    `json:"fid"`          // 文件在 115 的 id
+}
+
+// 在 115 确认文件已经上传后删除原文件，设置了 -done-dir 时移动原文件
+func (file *fileInfo) removeSource() error {
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return err
+	}
+	rf, err := file.findRemote(info)
+	if err != nil {
+		return fmt.Errorf("在 115 确认文件出现错误：%w", err)
+	}
+	if rf == nil {
+		return fmt.Errorf("115 的文件夹 %d 里没有这次上传的 sha1 为 %s 且大小为 %d 的文件", file.ParentID, file.sha1, info.Size())
+	}
+
+	record := removeRecord{
+		Time:   time.Now(),
+		Path:   file.Path,
+		Action: "删除",
+		Size:   info.Size(),
+		SHA1:   rf.SHA1,
+		CID:    file.ParentID,
+		FID:    rf.FID,
+	}
+	if abs, err := filepath.Abs(file.Path); err == nil {
+		record.Path = abs
+	}
+
+	if *doneDir != "" {
+		rel := file.Rel
+		if rel == "" {
+			rel = filepath.Base(file.Path)
+		}
+		record.Action = "移动"
+		record.To = filepath.Join(*doneDir, rel)
+		if err := moveFile(file.Path, record.To); err != nil {
+			return err
+		}
+		log.Printf("成功将原文件 %s 移动到 %s", file.Path, record.To)
+	} else {
+		if err := os.Remove(file.Path); err != nil {
+			return fmt.Errorf("删除原文件 %s 出现错误：%w", file.Path, err)
+		}
+		log.Printf("成功删除原文件 %s", file.Path)
+	}
+
+	if err := appendRemoveLog(record); err != nil {
+		log.Printf("记录删除的原文件 %s 出现错误：%v", file.Path, err)
+	}
+	return nil
+}
+
+// 移动文件，不会覆盖已经存在的文件，不能直接移动时复制后删除原文件
+func moveFile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s 已经存在", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	// 只有跨设备时才复制后删除原文件
+	if !isCrossDevice(err) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("复制 %s 到 %s 出现错误：%w", src, dst, err)
+	}
+	return os.Remove(src)
+}
+
+// 复制文件，保留文件的修改时间
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// 将删除原文件的记录追加到记录文件里
+func appendRemoveLog(record removeRecord) error {
+	file := *removeLog
+	if file == "" {
+		file = filepath.Join(*saveDir, "removed.log")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// 判断 path 是否是 -done-dir 指定的文件夹或者其子文件夹
+func isDoneDir(path string) bool {
+	if *doneDir == "" {
+		return false
+	}
+	dir, err := filepath.Abs(*doneDir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
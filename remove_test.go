@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	dst := filepath.Join(dir, "done", "sub", "a.txt")
+	if err := os.WriteFile(src, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveFile(src, dst); err != nil {
+		t.Errorf("move file error: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source file should not exist: %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "data" {
+		t.Errorf("moved file want: data, result: %s, error: %v", data, err)
+	}
+
+	// 不覆盖已经存在的文件
+	if err := os.WriteFile(src, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveFile(src, dst); err == nil {
+		t.Error("move file to an existing file should fail")
+	}
+}
+
+func TestMoveFileError(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "missing.txt")
+	dst := filepath.Join(dir, "done", "missing.txt")
+
+	// 不是跨设备的错误时直接返回，不复制文件
+	err := moveFile(src, dst)
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("move missing file should return the rename error, result: %v", err)
+	}
+	if isCrossDevice(err) {
+		t.Errorf("%v should not be a cross device error", err)
+	}
+	if !isCrossDevice(&os.LinkError{Op: "rename", Old: src, New: dst, Err: crossDeviceErr}) {
+		t.Error("cross device rename error should be detected")
+	}
+}
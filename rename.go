@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 115 网盘文件名的最大长度（字节）
+const maxNameLen = 255
+
+// 上传后的文件名的设置
+type renameOptions struct {
+	template string // 文件名模板
+	prefix   string // 文件名前缀
+	suffix   string // 文件名后缀，加在扩展名前面
+}
+
+var renameOpts renameOptions
+
+// 文件名模板和路径模板里的变量
+var templateVar = regexp.MustCompile(`\{[a-z]+\}`)
+
+// 文件名模板支持的变量，info 是上传的文件的信息
+var templateVars = map[string]func(info os.FileInfo) string{
+	"{name}": func(info os.FileInfo) string { return info.Name() },
+	"{base}": func(info os.FileInfo) string {
+		return strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+	},
+	"{ext}":  func(info os.FileInfo) string { return filepath.Ext(info.Name()) },
+	"{date}": func(info os.FileInfo) string { return info.ModTime().Format("2006-01-02") },
+	"{time}": func(info os.FileInfo) string { return info.ModTime().Format("150405") },
+	"{now}":  func(info os.FileInfo) string { return time.Now().Format("2006-01-02") },
+	"{size}": func(info os.FileInfo) string { return strconv.FormatInt(info.Size(), 10) },
+}
+
+// 检查文件名模板里的变量是否都支持
+func checkTemplate(template string) error {
+	for _, v := range templateVar.FindAllString(template, -1) {
+		if _, ok := templateVars[v]; !ok {
+			return fmt.Errorf("文件名模板 %s 里的变量 %s 不支持", template, v)
+		}
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("文件名模板 %s 不能包含 / 或 \\", template)
+	}
+	return nil
+}
+
+// 根据设置生成上传后的文件名
+func (opts *renameOptions) rename(info os.FileInfo) string {
+	name := info.Name()
+	if opts.template != "" {
+		name = templateVar.ReplaceAllStringFunc(opts.template, func(v string) string {
+			return templateVars[v](info)
+		})
+	}
+	if opts.prefix != "" || opts.suffix != "" {
+		ext := filepath.Ext(name)
+		name = opts.prefix + strings.TrimSuffix(name, ext) + opts.suffix + ext
+	}
+	return name
+}
+
+// 替换 115 不允许的字符以及会导致 CompleteMultipartUpload 的响应解析出错的 & 和 < ，
+// 过长的文件名会在保留扩展名的情况下截断
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`\/:*?"<>|&`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+
+	if len(name) > maxNameLen {
+		ext := filepath.Ext(name)
+		if len(ext) > maxNameLen/2 {
+			ext = ""
+		}
+		base := name[:maxNameLen-len(ext)]
+		// 避免截断在 UTF-8 字符中间
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+	return name
+}
+
+// 上传后的文件名，清单里指定的文件名优先于文件名模板
+func (file *fileInfo) remoteName(info os.FileInfo) string {
+	if file.Name != "" {
+		return sanitizeName(file.Name)
+	}
+	return sanitizeName(renameOpts.rename(info))
+}
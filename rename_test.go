@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		"a&b<c>.txt":   "a_b_c_.txt",
+		`x:y*z?"|.mp4`: "x_y_z___.mp4",
+		" ..":          "_..",
+		"正常.txt":       "正常.txt",
+	}
+	for name, want := range tests {
+		if result := sanitizeName(name); result != want {
+			t.Errorf("sanitized name of %s want: %s, result: %s", name, want, result)
+		}
+	}
+
+	long := sanitizeName(strings.Repeat("文", 100) + ".mp4")
+	if len(long) > maxNameLen || !strings.HasSuffix(long, "文.mp4") {
+		t.Errorf("long name is not truncated correctly: %s", long)
+	}
+}
+
+func TestRename(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := renameOptions{template: "{date}_{base}_{size}{ext}", prefix: "p-", suffix: "-s"}
+	if name := opts.rename(info); name != "p-2024-01-02_photo_4-s.jpg" {
+		t.Errorf("renamed name want: p-2024-01-02_photo_4-s.jpg, result: %s", name)
+	}
+	if err := checkTemplate("{unknown}_{name}"); err == nil {
+		t.Error("check template with unknown variable should fail")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 分享的设置
+type shareOptions struct {
+	days int    // 分享的有效天数，-1 为永久有效
+	code string // 分享的访问码，为空时由 115 随机生成
+}
+
+var (
+	shareUpload *bool // 上传完成后分享上传的文件和文件夹
+	shareOpts   shareOptions
+	shareDirs   []shareDir // 递归上传时创建的要分享的顶层文件夹
+)
+
+// 访问码只能是 4 位数字或字母
+var shareCodeRegexp = regexp.MustCompile(`^[0-9A-Za-z]{4}$`)
+
+// 递归上传时在 115 创建的顶层文件夹
+type shareDir struct {
+	path string // 本地文件夹的路径
+	cid  uint64 // 115 文件夹的 cid
+}
+
+// 分享的结果
+type shareResult struct {
+	Path  string `json:"path"`            // 分享的本地文件或文件夹的路径，和上传结果里的路径一致，share 子命令里是参数
+	Row   int    `json:"row,omitempty"`   // 分享的文件在清单里的行号，和上传结果的 rows 里的行号一致，不是来自清单时为 0
+	IsDir bool   `json:"isDir,omitempty"` // 分享的是否是递归上传时创建的顶层文件夹
+	ID    string `json:"id"`              // 分享的文件的 id 或者文件夹的 cid
+	URL   string `json:"url,omitempty"`   // 分享链接
+	Code  string `json:"code,omitempty"`  // 访问码
+	Days  int    `json:"days,omitempty"`  // 有效天数，-1 为永久有效
+	Error string `json:"error,omitempty"` // 分享出现的错误
+}
+
+// 检查分享的设置
+func (opts *shareOptions) check() error {
+	if opts.days != -1 && opts.days < 1 {
+		return fmt.Errorf("分享的有效天数 %d 不正确，必须大于 0 或者为 -1（永久有效）", opts.days)
+	}
+	if opts.code != "" && !shareCodeRegexp.MatchString(opts.code) {
+		return fmt.Errorf("分享的访问码 %s 不正确，必须是 4 位数字或字母", opts.code)
+	}
+	return nil
+}
+
+// 分享 115 网盘里的文件或文件夹，id 是文件的 id 或者文件夹的 cid
+func createShare(path, id string) shareResult {
+	sr := shareResult{Path: path, ID: id, Days: shareOpts.days}
+	err := func() error {
+		form := url.Values{}
+		form.Set("user_id", userID)
+		form.Set("file_ids", id)
+		form.Set("ignore_warn", "1")
+		v, err := postFormJSON(shareSendURL, form.Encode())
+		if err != nil {
+			return err
+		}
+		if !v.GetBool("state") {
+			return fmt.Errorf("创建分享失败：%s", v.GetStringBytes("error"))
+		}
+		shareCode := string(v.GetStringBytes("data", "share_code"))
+		sr.Code = string(v.GetStringBytes("data", "receive_code"))
+		sr.URL = string(v.GetStringBytes("data", "share_url"))
+		if shareCode == "" {
+			return errors.New("创建分享失败：没有返回分享码")
+		}
+
+		// 设置有效天数和访问码
+		form = url.Values{}
+		form.Set("share_code", shareCode)
+		form.Set("share_duration", strconv.Itoa(shareOpts.days))
+		if shareOpts.code != "" {
+			form.Set("receive_code", shareOpts.code)
+			form.Set("is_custom_code", "1")
+		}
+		v, err = postFormJSON(shareUpdateURL, form.Encode())
+		if err != nil {
+			return err
+		}
+		if !v.GetBool("state") {
+			return fmt.Errorf("设置分享失败：%s", v.GetStringBytes("error"))
+		}
+		if shareOpts.code != "" {
+			sr.Code = shareOpts.code
+		}
+		if sr.URL == "" {
+			sr.URL = "https://115.com/s/" + shareCode
+		}
+		if !strings.Contains(sr.URL, "password=") && sr.Code != "" {
+			sr.URL += "?password=" + sr.Code
+		}
+		return nil
+	}()
+	if err != nil {
+		sr.Error = err.Error()
+	}
+	return sr
+}
+
+// 记录分享结果
+func recordShare(sr shareResult) {
+	if sr.Error != "" {
+		log.Printf("分享 %s 出现错误：%s", sr.Path, sr.Error)
+	} else {
+		log.Printf("分享 %s 成功：%s 访问码：%s", sr.Path, sr.URL, sr.Code)
+	}
+	result.Shares = append(result.Shares, sr)
+}
+
+// 分享上传成功的文件，递归上传的文件夹里的文件由 shareUploadedDirs() 分享其顶层文件夹，
+// 按日期分配文件夹时没有顶层文件夹，直接分享每个文件
+func (file *fileInfo) share() {
+	if file.Rel != "" && dateLayout == "" {
+		return
+	}
+	sr := shareResult{Path: file.Path, Row: file.Row}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		sr.Error = err.Error()
+		recordShare(sr)
+		return
+	}
+	// 和 -e 一样只分享在 115 确认是这次上传的文件
+	rf, err := file.findRemote(info)
+	if err == nil && rf == nil {
+		err = errors.New("在 115 没有找到这次上传的文件")
+	}
+	if err != nil {
+		sr.Error = err.Error()
+		recordShare(sr)
+		return
+	}
+	sr = createShare(file.Path, rf.FID)
+	sr.Row = file.Row
+	recordShare(sr)
+}
+
+// 文件夹里有文件上传失败或者只上传了一部分时返回不分享的原因
+func unfinishedDir(dir string) string {
+	for _, f := range result.Failed {
+		if inDir(dir, f) {
+			return "文件夹里有文件上传失败，不分享该文件夹"
+		}
+	}
+	for _, f := range result.Saved {
+		if inDir(dir, f) {
+			return "文件夹里有文件没有上传完成，不分享该文件夹"
+		}
+	}
+	return ""
+}
+
+// 判断 path 是否在 dir 文件夹里，dir 可以是 . 这样的相对路径
+func inDir(dir, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// 分享递归上传时创建的顶层文件夹，文件夹里有文件上传失败或者没有上传完成时不分享
+func shareUploadedDirs() {
+	for _, dir := range shareDirs {
+		id := strconv.FormatUint(dir.cid, 10)
+		if reason := unfinishedDir(dir.path); reason != "" {
+			recordShare(shareResult{Path: dir.path, IsDir: true, ID: id, Error: reason})
+			continue
+		}
+		sr := createShare(dir.path, id)
+		sr.IsDir = true
+		recordShare(sr)
+	}
+}
+
+// share 子命令，分享 115 里的文件或文件夹
+func shareCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("用法：share 文件或文件夹...")
+	}
+	entries, err := resolveRemoteEntries(args)
+	if err != nil {
+		return err
+	}
+
+	shares := make([]shareResult, 0, len(entries))
+	var errs []error
+	for _, entry := range entries {
+		sr := createShare(entry.Source, entry.ID)
+		if sr.Error != "" {
+			errs = append(errs, fmt.Errorf("分享 %s 出现错误：%s", sr.Path, sr.Error))
+		}
+		shares = append(shares, sr)
+	}
+
+	if *jsonOutput {
+		if err := printJSON(shares); err != nil {
+			return err
+		}
+	} else {
+		for _, sr := range shares {
+			if sr.Error == "" {
+				fmt.Printf("%s %s 访问码：%s\n", sr.Path, sr.URL, sr.Code)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestShareOptionsCheck(t *testing.T) {
+	tests := []struct {
+		opts shareOptions
+		ok   bool
+	}{
+		{shareOptions{days: 7}, true},
+		{shareOptions{days: -1, code: "a1B2"}, true},
+		{shareOptions{days: 0}, false},
+		{shareOptions{days: -2}, false},
+		{shareOptions{days: 1, code: "abc"}, false},
+		{shareOptions{days: 1, code: "ab_c"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.check(); (err == nil) != tt.ok {
+			t.Errorf("check %+v want ok: %v, result: %v", tt.opts, tt.ok, err)
+		}
+	}
+}
+
+func TestUnfinishedDir(t *testing.T) {
+	defer func(r resultData) { result = r }(result)
+	dir := filepath.Join("data", "cam")
+	tests := []struct {
+		result resultData
+		ok     bool
+	}{
+		{resultData{Success: []string{filepath.Join(dir, "a.jpg")}}, true},
+		{resultData{Failed: []string{filepath.Join(dir, "sub", "a.jpg")}}, false},
+		{resultData{Saved: []string{filepath.Join(dir, "big.mp4")}}, false},
+		{resultData{Failed: []string{filepath.Join("data", "camera", "a.jpg")}, Saved: []string{dir}}, true},
+	}
+	for _, tt := range tests {
+		result = tt.result
+		if reason := unfinishedDir(dir); (reason == "") != tt.ok {
+			t.Errorf("unfinished dir with %+v want ok: %v, result: %s", tt.result, tt.ok, reason)
+		}
+	}
+
+	// 上传的文件夹是 . 或者 ./sub 这样的相对路径
+	abs, err := filepath.Abs(filepath.Join("sub", "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirTests := []struct {
+		dir    string
+		result resultData
+		ok     bool
+	}{
+		{".", resultData{Failed: []string{"a.jpg"}}, false},
+		{".", resultData{Saved: []string{filepath.Join("sub", "big.mp4")}}, false},
+		{".", resultData{Failed: []string{filepath.Join("..", "a.jpg")}}, true},
+		{"." + string(filepath.Separator) + "sub", resultData{Failed: []string{filepath.Join("sub", "a.jpg")}}, false},
+		{"." + string(filepath.Separator) + "sub", resultData{Failed: []string{abs}}, false},
+		{"." + string(filepath.Separator) + "sub", resultData{Failed: []string{filepath.Join("subdir", "a.jpg")}}, true},
+		{"." + string(filepath.Separator) + "sub", resultData{Failed: []string{"a.jpg"}}, true},
+	}
+	for _, tt := range dirTests {
+		result = tt.result
+		if reason := unfinishedDir(tt.dir); (reason == "") != tt.ok {
+			t.Errorf("unfinished dir %s with %+v want ok: %v, result: %s", tt.dir, tt.result, tt.ok, reason)
+		}
+	}
+}
+
+func TestFileShare(t *testing.T) {
+	defer func(r resultData, layout string) { result, dateLayout = r, layout }(result, dateLayout)
+	result = resultData{}
+	missing := filepath.Join(t.TempDir(), "cam", "a.jpg")
+
+	// 递归上传的文件由顶层文件夹分享
+	dateLayout = ""
+	file := fileInfo{Path: missing, Rel: filepath.Join("cam", "a.jpg")}
+	file.share()
+	if len(result.Shares) != 0 {
+		t.Errorf("file in shared dir should not be shared: %+v", result.Shares)
+	}
+
+	// 按日期分配文件夹时分享每个文件
+	dateLayout = "{yyyy}"
+	file.share()
+	// 清单里的文件记录行号
+	dateLayout = ""
+	file = fileInfo{Path: missing, Row: 3}
+	file.share()
+	if len(result.Shares) != 2 {
+		t.Fatalf("shares want: 2, result: %d", len(result.Shares))
+	}
+	for i, row := range []int{0, 3} {
+		sr := result.Shares[i]
+		if sr.Path != missing || sr.Row != row || sr.Error == "" || sr.IsDir {
+			t.Errorf("share %d want path %s row %d with error, result: %+v", i, missing, row, sr)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 快照文件夹的名字格式
+const snapshotLayout = "2006-01-02_150405"
+
+// 快照的保留规则
+type retention struct {
+	last    int // 保留最近的快照数量
+	daily   int // 每天保留一个快照的天数
+	monthly int // 每月保留一个快照的月数
+}
+
+var keep retention
+
+// 115 网盘里的快照文件夹
+type snapshotDir struct {
+	remoteDir
+	Time time.Time // 快照的时间
+}
+
+// 在 root 文件夹里以当前时间命名创建快照文件夹，返回快照文件夹的 cid
+func createSnapshot(root uint64) (uint64, error) {
+	name := time.Now().Format(snapshotLayout)
+	cid, err := createDir(root, name)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("上传文件到快照文件夹 %s ，cid：%d", name, cid)
+	return cid, nil
+}
+
+// 列出 root 文件夹里的快照文件夹
+func listSnapshots(root uint64) ([]snapshotDir, error) {
+	dirs, err := listRemoteDirs(root)
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]snapshotDir, 0, len(dirs))
+	for _, dir := range dirs {
+		t, err := time.ParseInLocation(snapshotLayout, dir.Name, time.Local)
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, snapshotDir{remoteDir: dir, Time: t})
+	}
+	return snaps, nil
+}
+
+// 根据保留规则选出要删除的快照，按天和按月保留的快照从 now 所在的那天和那个月往前算
+func (r retention) prune(snaps []snapshotDir, now time.Time) (remove []snapshotDir) {
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Time.After(snaps[j].Time)
+	})
+
+	y, m, d := now.Date()
+	dayStart := time.Date(y, m, d-r.daily+1, 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(y, m-time.Month(r.monthly)+1, 1, 0, 0, 0, 0, now.Location())
+	days := make(map[string]bool)
+	months := make(map[string]bool)
+	for i, snap := range snaps {
+		kept := i < r.last
+		if day := snap.Time.Format("2006-01-02"); r.daily > 0 && !snap.Time.Before(dayStart) && !days[day] {
+			days[day] = true
+			kept = true
+		}
+		if month := snap.Time.Format("2006-01"); r.monthly > 0 && !snap.Time.Before(monthStart) && !months[month] {
+			months[month] = true
+			kept = true
+		}
+		if !kept {
+			remove = append(remove, snap)
+		}
+	}
+
+	return remove
+}
+
+// 按照保留规则删除 root 文件夹里旧的快照文件夹，current 是本次运行的快照文件夹
+func pruneSnapshots(root, current uint64) error {
+	if keep == (retention{}) {
+		return nil
+	}
+	snaps, err := listSnapshots(root)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, snap := range keep.prune(snaps, time.Now()) {
+		if snap.CID == current {
+			continue
+		}
+		log.Printf("删除快照文件夹 %s ，cid：%d", snap.Name, snap.CID)
+		if err := deleteRemote(root, strconv.FormatUint(snap.CID, 10)); err != nil {
+			errs = append(errs, fmt.Errorf("删除快照文件夹 %s 出现错误：%w", snap.Name, err))
+			continue
+		}
+		dirCache.invalidate(snap.CID)
+	}
+
+	return errors.Join(errs...)
+}
+
+// 演习时还没创建快照文件夹，把要上传到快照文件夹里的文件标记为上传到新建的快照文件夹 name 里
+func (plan *uploadPlan) pendingSnapshot(name string) {
+	for i := range plan.Files {
+		entry := &plan.Files[i]
+		if strings.HasPrefix(entry.RemoteDir, "/") {
+			// 从根目录开始的路径不在快照文件夹里
+			continue
+		}
+		entry.RemoteDir = path.Join(name, entry.RemoteDir)
+		entry.DirPending = true
+	}
+}
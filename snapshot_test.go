@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetentionPrune(t *testing.T) {
+	var snaps []snapshotDir
+	add := func(s string) {
+		tm, err := time.ParseInLocation(snapshotLayout, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snaps = append(snaps, snapshotDir{remoteDir: remoteDir{Name: s}, Time: tm})
+	}
+	for _, s := range []string{
+		"2024-03-10_120000", "2024-03-10_080000", "2024-03-09_120000", "2024-03-08_120000",
+		"2024-02-20_120000", "2024-02-01_120000", "2024-01-15_120000", "2023-12-31_120000",
+	} {
+		add(s)
+	}
+
+	r := retention{last: 1, daily: 2, monthly: 3}
+	var removed []string
+	now := time.Date(2024, 3, 10, 18, 0, 0, 0, time.Local)
+	for _, snap := range r.prune(snaps, now) {
+		removed = append(removed, snap.Name)
+	}
+	want := []string{"2024-03-10_080000", "2024-03-08_120000", "2024-02-01_120000", "2023-12-31_120000"}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed snapshots want: %v, result: %v", want, removed)
+	}
+}
+
+func TestRetentionPruneGap(t *testing.T) {
+	var snaps []snapshotDir
+	for _, s := range []string{"2024-03-10_120000", "2024-03-05_120000", "2024-03-04_120000", "2023-12-31_120000"} {
+		tm, err := time.ParseInLocation(snapshotLayout, s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snaps = append(snaps, snapshotDir{remoteDir: remoteDir{Name: s}, Time: tm})
+	}
+
+	// 按日历计算保留的天数和月数，没有快照的日子和月份也算在内
+	now := time.Date(2024, 3, 10, 18, 0, 0, 0, time.Local)
+	tests := []struct {
+		r    retention
+		want []string
+	}{
+		{retention{daily: 2}, []string{"2024-03-05_120000", "2024-03-04_120000", "2023-12-31_120000"}},
+		{retention{daily: 6}, []string{"2024-03-04_120000", "2023-12-31_120000"}},
+		{retention{monthly: 3}, []string{"2024-03-05_120000", "2024-03-04_120000", "2023-12-31_120000"}},
+		{retention{monthly: 4}, []string{"2024-03-05_120000", "2024-03-04_120000"}},
+	}
+	for _, tt := range tests {
+		var removed []string
+		for _, snap := range tt.r.prune(snaps, now) {
+			removed = append(removed, snap.Name)
+		}
+		if !reflect.DeepEqual(removed, tt.want) {
+			t.Errorf("removed snapshots with %+v want: %v, result: %v", tt.r, tt.want, removed)
+		}
+	}
+}
+
+func TestPendingSnapshot(t *testing.T) {
+	plan := &uploadPlan{Files: []planEntry{
+		{fileInfo: fileInfo{ParentID: 1, Name: "a.txt"}},
+		{fileInfo: fileInfo{ParentID: 2, Name: "b.txt", RemoteDir: "sub"}},
+		{fileInfo: fileInfo{ParentID: 3, Name: "c.txt", RemoteDir: "/abs"}},
+	}}
+	plan.pendingSnapshot("2024-03-10_120000")
+
+	want := []struct {
+		dir     string
+		pending bool
+	}{{"2024-03-10_120000", true}, {"2024-03-10_120000/sub", true}, {"/abs", false}}
+	for i, entry := range plan.Files {
+		if entry.RemoteDir != want[i].dir || entry.DirPending != want[i].pending {
+			t.Errorf("%s remote dir want: %s pending %v, result: %s pending %v",
+				entry.Name, want[i].dir, want[i].pending, entry.RemoteDir, entry.DirPending)
+		}
+	}
+}
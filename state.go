@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 最多保存的运行记录数量
+const maxRuns = 100
+
+// 上传状态里已经上传的文件
+type stateEntry struct {
+	Size     int64     `json:"size"`     // 文件大小
+	ModTime  int64     `json:"modTime"`  // 文件的修改时间（纳秒）
+	SHA1     string    `json:"sha1"`     // 文件的 sha1 值
+	CID      uint64    `json:"cid"`      // 文件在 115 所在的文件夹的 cid
+	FID      string    `json:"fid"`      // 文件在 115 的 id
+	Uploaded time.Time `json:"uploaded"` // 上传的时间
+}
+
+// 一次运行的记录
+type runRecord struct {
+	Start     time.Time  `json:"start"`               // 开始运行的时间
+	End       time.Time  `json:"end"`                 // 结束运行的时间
+	Args      []string   `json:"args"`                // 命令行参数
+	Bytes     int64      `json:"bytes"`               // 上传成功的文件的总大小
+	Unchanged int        `json:"unchanged,omitempty"` // 增量上传时跳过的没有改变的文件的数量
+	Result    resultData `json:"result"`              // 上传结果
+}
+
+// 保存在本地文件里的上传状态
+type uploadStateData struct {
+	mu      sync.Mutex
+	file    string                           // 状态文件
+	changed bool                             // 状态是否有改动
+	start   time.Time                        // 本次运行开始的时间
+	bytes   int64                            // 本次运行上传成功的文件的总大小
+	ended   bool                             // 本次运行是否已经记录
+	Roots   map[string]map[string]stateEntry `json:"roots"` // 以上传的文件夹的绝对路径和文件相对该文件夹的路径为键
+	Runs    []runRecord                      `json:"runs"`  // 运行记录，按时间升序
+}
+
+var (
+	uploadState    *uploadStateData // 上传状态，为 nil 时不记录
+	unchangedFiles int              // 增量上传时跳过的没有改变的文件的数量
+)
+
+// 读取上传状态文件，文件不存在时新建状态
+func loadUploadState(file string) (us *uploadStateData, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			e = fmt.Errorf("loadUploadState() error: %v", err)
+		}
+	}()
+
+	us = &uploadStateData{file: file, start: time.Now(), Roots: make(map[string]map[string]stateEntry)}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return us, nil
+	}
+	checkErr(err)
+	err = json.Unmarshal(data, us)
+	checkErr(err)
+	if us.Roots == nil {
+		us.Roots = make(map[string]map[string]stateEntry)
+	}
+
+	return us, nil
+}
+
+// 文件在上传状态里的键，root 是上传的文件夹（上传单个文件时是文件所在的文件夹）的绝对路径，
+// rel 是递归上传文件夹时文件相对上传的文件夹的上级文件夹的路径
+func stateKey(path, rel string) (root, key string, e error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	if rel == "" {
+		return filepath.Dir(abs), filepath.Base(abs), nil
+	}
+
+	rel = filepath.ToSlash(rel)
+	i := strings.IndexByte(rel, '/')
+	if i < 0 || !strings.HasSuffix(filepath.ToSlash(abs), "/"+rel[i+1:]) {
+		return filepath.Dir(abs), filepath.Base(abs), nil
+	}
+	key = rel[i+1:]
+	root = abs[:len(abs)-len(key)-1]
+	return root, key, nil
+}
+
+// 判断文件自从上次上传后是否没有改变
+func (us *uploadStateData) unchanged(path, rel string, info fs.FileInfo) bool {
+	if us == nil {
+		return false
+	}
+	root, key, err := stateKey(path, rel)
+	if err != nil {
+		return false
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	entry, ok := us.Roots[root][key]
+	return ok && entry.Size == info.Size() && entry.ModTime == info.ModTime().UnixNano()
+}
+
+// 增量上传时跳过上次上传后没有改变的文件
+func skipUnchanged(path, rel string, info fs.FileInfo) bool {
+	if !*incremental || !uploadState.unchanged(path, rel, info) {
+		return false
+	}
+	if *verbose {
+		log.Printf("跳过没有改变的文件 %s", path)
+	}
+	unchangedFiles++
+	return true
+}
+
+// 记录上传成功的文件
+func (us *uploadStateData) record(file *fileInfo, info fs.FileInfo, rf *remoteFile) {
+	if us == nil {
+		return
+	}
+	root, key, err := stateKey(file.Path, file.Rel)
+	if err != nil {
+		return
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.Roots[root] == nil {
+		us.Roots[root] = make(map[string]stateEntry)
+	}
+	us.Roots[root][key] = stateEntry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		SHA1:     rf.SHA1,
+		CID:      file.ParentID,
+		FID:      rf.FID,
+		Uploaded: time.Now(),
+	}
+	us.bytes += info.Size()
+	us.changed = true
+}
+
+// 记录本次运行的上传结果
+func (us *uploadStateData) endRun() {
+	if us == nil || cmdName != "" {
+		return
+	}
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.ended {
+		return
+	}
+	us.ended = true
+	// 没有处理任何文件时不记录，增量上传时所有文件都没有改变也要记录
+	if len(result.Success) == 0 && len(result.Failed) == 0 && len(result.Saved) == 0 &&
+		len(result.Skipped) == 0 && unchangedFiles == 0 {
+		return
+	}
+	us.Runs = append(us.Runs, runRecord{
+		Start:     us.start,
+		End:       time.Now(),
+		Args:      redactArgs(os.Args[1:]),
+		Bytes:     us.bytes,
+		Unchanged: unchangedFiles,
+		Result:    result,
+	})
+	if len(us.Runs) > maxRuns {
+		us.Runs = us.Runs[len(us.Runs)-maxRuns:]
+	}
+	us.changed = true
+}
+
+// 运行记录里要隐藏值的参数：Cookie 和分享的访问码
+var redactedFlags = map[string]bool{"k": true, "share-code": true}
+
+// 隐藏命令行参数里的 Cookie 和分享的访问码
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i, arg := range redacted {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || !redactedFlags[name] {
+			continue
+		}
+		if hasValue {
+			redacted[i] = arg[:strings.IndexByte(arg, '=')+1] + "***"
+		} else if i+1 < len(redacted) {
+			redacted[i+1] = "***"
+		}
+	}
+	return redacted
+}
+
+// 保存上传状态到文件
+func (us *uploadStateData) save() {
+	if us == nil {
+		return
+	}
+	us.endRun()
+
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if !us.changed {
+		return
+	}
+	if err := writeJSONFile(us.file, us); err != nil {
+		log.Printf("保存上传状态文件 %s 出现错误：%v", us.file, err)
+		return
+	}
+	us.changed = false
+}
+
+// 在上传状态里记录上传成功的文件
+func (file *fileInfo) recordState() {
+	if uploadState == nil {
+		return
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return
+	}
+	rf, err := file.findRemote(info)
+	if err != nil || rf == nil {
+		log.Printf("在 115 查找 %s 出现错误，上传状态里不记录该文件：%v", file.Path, err)
+		return
+	}
+	uploadState.record(file, info, rf)
+}
+
+// history 子命令，列出运行记录，指定序号时显示该次运行的上传结果
+func historyCommand(args []string) error {
+	if uploadState == nil {
+		return fmt.Errorf("没有设置上传状态文件，请设置设置文件的 stateFile 或者使用参数 -state")
+	}
+
+	runs := uploadState.Runs
+	if len(args) == 0 {
+		for i, run := range runs {
+			fmt.Printf("%d. %s 用时 %s 成功 %d 失败 %d 保存进度 %d 跳过 %d 没有改变 %d 上传 %s\n", i+1,
+				run.Start.Format("2006-01-02 15:04:05"), run.End.Sub(run.Start).Round(time.Second),
+				len(run.Result.Success), len(run.Result.Failed), len(run.Result.Saved), len(run.Result.Skipped),
+				run.Unchanged, formatSize(run.Bytes))
+		}
+		fmt.Printf("共有 %d 次运行记录\n", len(runs))
+		return nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(runs) {
+		return fmt.Errorf("运行记录的序号 %s 不正确，范围为 1 到 %d", args[0], len(runs))
+	}
+	run := runs[n-1]
+	fmt.Printf("开始时间：%s\n结束时间：%s\n参数：%s\n上传：%s\n没有改变的文件：%d\n",
+		run.Start.Format("2006-01-02 15:04:05"), run.End.Format("2006-01-02 15:04:05"),
+		strings.Join(run.Args, " "), formatSize(run.Bytes), run.Unchanged)
+	for _, list := range []struct {
+		name  string
+		files []string
+	}{
+		{"上传成功的文件", run.Result.Success},
+		{"上传失败的文件", run.Result.Failed},
+		{"保存上传进度的文件", run.Result.Saved},
+		{"跳过的文件", run.Result.Skipped},
+	} {
+		fmt.Printf("%s（%d）：\n", list.name, len(list.files))
+		for _, s := range list.files {
+			fmt.Println(s)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStateKey(t *testing.T) {
+	dir := t.TempDir()
+	root, key, err := stateKey(filepath.Join(dir, "cam", "2024", "a.jpg"), filepath.Join("cam", "2024", "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != filepath.Join(dir, "cam") || key != "2024/a.jpg" {
+		t.Errorf("state key want: %s 2024/a.jpg, result: %s %s", filepath.Join(dir, "cam"), root, key)
+	}
+
+	root, key, err = stateKey(filepath.Join(dir, "b.txt"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != dir || key != "b.txt" {
+		t.Errorf("state key want: %s b.txt, result: %s %s", dir, root, key)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"-k", "cookie", "-k=cookie", "-share-code", "abcd", "--share-code=abcd", "-u", "file"}
+	want := []string{"-k", "***", "-k=***", "-share-code", "***", "--share-code=***", "-u", "file"}
+	if result := redactArgs(args); !reflect.DeepEqual(result, want) {
+		t.Errorf("redacted args want: %v, result: %v", want, result)
+	}
+}
+
+func TestEndRun(t *testing.T) {
+	defer func(r resultData, n int, name string) { result, unchangedFiles, cmdName = r, n, name }(result, unchangedFiles, cmdName)
+	cmdName = ""
+
+	tests := []struct {
+		name      string
+		result    resultData
+		unchanged int
+		want      bool
+	}{
+		{"nothing", resultData{}, 0, false},
+		{"success", resultData{Success: []string{"a"}}, 0, true},
+		{"skipped", resultData{Skipped: []string{"a（特殊文件）"}}, 0, true},
+		{"all unchanged", resultData{}, 3, true},
+	}
+	for _, tt := range tests {
+		result, unchangedFiles = tt.result, tt.unchanged
+		us := &uploadStateData{}
+		us.endRun()
+		if recorded := len(us.Runs) == 1; recorded != tt.want {
+			t.Errorf("%s: run recorded want: %v, result: %v", tt.name, tt.want, recorded)
+			continue
+		}
+		if tt.want && us.Runs[0].Unchanged != tt.unchanged {
+			t.Errorf("%s: unchanged files want: %d, result: %d", tt.name, tt.unchanged, us.Runs[0].Unchanged)
+		}
+	}
+}
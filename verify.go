@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// verify 子命令的比较结果
+type verifyReport struct {
+	Matched    int              `json:"matched"`    // 一致的文件数量
+	Missing    []string         `json:"missing"`    // 115 里没有的本地文件
+	Extra      []string         `json:"extra"`      // 本地没有的 115 里的文件
+	Mismatched []verifyMismatch `json:"mismatched"` // 大小或 sha1 不一致的文件
+}
+
+// 大小或 sha1 不一致的文件
+type verifyMismatch struct {
+	Path       string `json:"path"`            // 文件相对比较的文件夹的路径
+	LocalSize  int64  `json:"localSize"`       // 本地文件的大小
+	RemoteSize int64  `json:"remoteSize"`      // 115 里的文件的大小
+	LocalSHA1  string `json:"localSHA1"`       // 本地文件的 sha1 值，大小不一致时不计算
+	RemoteSHA1 string `json:"remoteSHA1"`      // 115 里的文件的 sha1 值
+	Error      string `json:"error,omitempty"` // 计算本地文件的 sha1 值出现的错误
+}
+
+// 本地文件
+type localEntry struct {
+	path string // 文件路径
+	size int64  // 文件大小
+}
+
+// 计算本地文件的 sha1 值，优先使用 hash 缓存
+func localSHA1(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fh, err := cachedHashFile(f, false, nil, false, nil)
+	if err != nil {
+		return "", err
+	}
+	return fh.TotalHash, nil
+}
+
+// 比较本地文件和 115 里的文件，键都是文件相对比较的文件夹的路径
+func compareTrees(local map[string]localEntry, remote map[string]remoteFile, hash func(string) (string, error)) *verifyReport {
+	report := &verifyReport{Missing: []string{}, Extra: []string{}, Mismatched: []verifyMismatch{}}
+	keys := make([]string, 0, len(local))
+	for key := range local {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		l := local[key]
+		r, ok := remote[key]
+		if !ok {
+			report.Missing = append(report.Missing, key)
+			continue
+		}
+		m := verifyMismatch{Path: key, LocalSize: l.size, RemoteSize: r.Size, RemoteSHA1: r.SHA1}
+		if l.size != r.Size {
+			report.Mismatched = append(report.Mismatched, m)
+			continue
+		}
+		sha1, err := hash(l.path)
+		if err != nil {
+			m.Error = err.Error()
+			report.Mismatched = append(report.Mismatched, m)
+			continue
+		}
+		if !strings.EqualFold(sha1, r.SHA1) {
+			m.LocalSHA1 = sha1
+			report.Mismatched = append(report.Mismatched, m)
+			continue
+		}
+		report.Matched++
+	}
+
+	for key := range remote {
+		if _, ok := local[key]; !ok {
+			report.Extra = append(report.Extra, key)
+		}
+	}
+	sort.Strings(report.Extra)
+
+	return report
+}
+
+// 本地文件上传到 115 后相对上传的文件夹的路径，文件名里 115 不允许的字符会被替换，
+// 文件夹名和创建文件夹时一样保持不变
+func remoteRelPath(rel string) string {
+	dir, name := path.Split(filepath.ToSlash(rel))
+	return path.Join(dir, sanitizeName(name))
+}
+
+// verify 子命令，比较本地文件夹和 115 里的文件夹的文件名、大小和 sha1 值
+func verifyCommand(args []string) error {
+	if len(args) != 2 {
+		return errors.New("用法：verify 本地文件夹 115文件夹的cid或路径")
+	}
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s 不是文件夹", args[0])
+	}
+	cid, err := resolveRemoteDir(args[1])
+	if err != nil {
+		return err
+	}
+
+	files, err := walkLocal(filepath.Clean(args[0]))
+	if err != nil {
+		return err
+	}
+	local := make(map[string]localEntry, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file.Path)
+		if err != nil {
+			return err
+		}
+		// 去掉 Rel 开头的上传的文件夹的名字
+		_, rel, _ := strings.Cut(filepath.ToSlash(file.Rel), "/")
+		local[remoteRelPath(rel)] = localEntry{path: file.Path, size: info.Size()}
+	}
+
+	remote := make(map[string]remoteFile)
+	err = walkRemote(cid, func(dir string, pid uint64, file remoteFile) {
+		remote[path.Join(dir, file.Name)] = file
+	})
+	if err != nil {
+		return err
+	}
+
+	report := compareTrees(local, remote, localSHA1)
+	if *jsonOutput {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range report.Missing {
+			fmt.Printf("缺少：%s\n", p)
+		}
+		for _, p := range report.Extra {
+			fmt.Printf("多余：%s\n", p)
+		}
+		for _, m := range report.Mismatched {
+			switch {
+			case m.Error != "":
+				fmt.Printf("无法比较：%s ：%s\n", m.Path, m.Error)
+			case m.LocalSize != m.RemoteSize:
+				fmt.Printf("大小不一致：%s 本地 %d 115 %d\n", m.Path, m.LocalSize, m.RemoteSize)
+			default:
+				fmt.Printf("sha1 不一致：%s 本地 %s 115 %s\n", m.Path, m.LocalSHA1, m.RemoteSHA1)
+			}
+		}
+		fmt.Printf("一致 %d 缺少 %d 多余 %d 不一致 %d\n", report.Matched, len(report.Missing), len(report.Extra), len(report.Mismatched))
+	}
+
+	if n := len(report.Missing) + len(report.Extra) + len(report.Mismatched); n != 0 {
+		return &commandError{code: 2, err: fmt.Errorf("有 %d 个文件不一致", n)}
+	}
+	return nil
+}
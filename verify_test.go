@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCompareTrees(t *testing.T) {
+	local := map[string]localEntry{
+		"a.txt":     {path: "a.txt", size: 1},
+		"sub/b.txt": {path: "b.txt", size: 2},
+		"c.txt":     {path: "c.txt", size: 3},
+		"d.txt":     {path: "d.txt", size: 4},
+		"e.txt":     {path: "e.txt", size: 5},
+	}
+	remote := map[string]remoteFile{
+		"a.txt":     {Size: 1, SHA1: "aaaa"},
+		"sub/b.txt": {Size: 2, SHA1: "BBBB"},
+		"c.txt":     {Size: 30, SHA1: "cccc"},
+		"e.txt":     {Size: 5, SHA1: "eeee"},
+		"f.txt":     {Size: 6, SHA1: "ffff"},
+	}
+	hashes := map[string]string{"a.txt": "AAAA", "b.txt": "bbbb"}
+	hash := func(path string) (string, error) {
+		if sha1, ok := hashes[path]; ok {
+			return sha1, nil
+		}
+		return "", errors.New("read error")
+	}
+
+	report := compareTrees(local, remote, hash)
+	if report.Matched != 2 {
+		t.Errorf("matched want: 2, result: %d", report.Matched)
+	}
+	if !reflect.DeepEqual(report.Missing, []string{"d.txt"}) {
+		t.Errorf("missing want: [d.txt], result: %v", report.Missing)
+	}
+	if !reflect.DeepEqual(report.Extra, []string{"f.txt"}) {
+		t.Errorf("extra want: [f.txt], result: %v", report.Extra)
+	}
+	if len(report.Mismatched) != 2 || report.Mismatched[0].Path != "c.txt" || report.Mismatched[1].Error == "" {
+		t.Errorf("mismatched result: %+v", report.Mismatched)
+	}
+}
+
+func TestRemoteRelPath(t *testing.T) {
+	tests := map[string]string{
+		"a.txt":                     "a.txt",
+		"sub/a&b.txt":               "sub/a_b.txt",
+		"a&b/c:d/e<f.txt":           "a&b/c:d/e_f.txt",
+		filepath.Join("x", "y.txt"): "x/y.txt",
+	}
+	for rel, want := range tests {
+		if result := remoteRelPath(rel); result != want {
+			t.Errorf("remote path of %s want: %s, result: %s", rel, want, result)
+		}
+	}
+}
+
+func TestWalkLocalIncremental(t *testing.T) {
+	verbose = new(bool)
+	doneDir = new(string)
+	emptyDirs = new(bool)
+	followSymlinks = new(bool)
+	defer func(inc *bool, us *uploadStateData) {
+		incremental, uploadState = inc, us
+	}(incremental, uploadState)
+	incremental = new(bool)
+	*incremental = true
+
+	root := filepath.Join(t.TempDir(), "cam")
+	for _, name := range []string{"a.jpg", "sub/b.jpg"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a.jpg 已经上传过并且没有改变
+	info, err := os.Stat(filepath.Join(root, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadState = &uploadStateData{Roots: map[string]map[string]stateEntry{
+		root: {"a.jpg": {Size: info.Size(), ModTime: info.ModTime().UnixNano()}},
+	}}
+
+	files, err := walkLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, file := range files {
+		rels = append(rels, filepath.ToSlash(file.Rel))
+	}
+	sort.Strings(rels)
+	want := []string{"cam/a.jpg", "cam/sub/b.jpg"}
+	if !reflect.DeepEqual(rels, want) {
+		t.Errorf("local files want: %v, result: %v", want, rels)
+	}
+}
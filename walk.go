@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 递归遍历要上传的文件夹
+type walker struct {
+	root    string            // 要上传的文件夹
+	pid     uint64            // 要上传到的 115 文件夹的 cid
+	filter  *walkFilter       // 过滤要上传的文件
+	cidMap  map[string]uint64 // 已创建的文件夹的路径对应的 cid
+	visited map[string]bool   // 已经遍历过的文件夹的真实路径
+	pending map[string]bool   // 演习时还没在 115 创建的文件夹
+	noDirs  bool              // 不在 115 创建对应的文件夹
+	all     bool              // 增量上传时也不跳过没有改变的文件
+	files   []fileInfo        // 要上传的文件
+}
+
+// 递归遍历要上传的文件夹，在 115 网盘的 pid 文件夹里创建对应的文件夹，返回要上传的文件
+func walkDir(root string, pid uint64) (files []fileInfo, e error) {
+	// 按日期分配文件夹时之后再设置要上传到的文件夹
+	w := newWalker(root, pid, dateLayout != "")
+	files, e = w.run()
+	if *shareUpload && !w.noDirs {
+		if cid := w.cidMap[root]; cid != 0 {
+			shareDirs = append(shareDirs, shareDir{path: root, cid: cid})
+		}
+	}
+	return files, e
+}
+
+// 递归遍历本地文件夹，不在 115 创建文件夹，返回文件夹里的所有文件
+func walkLocal(root string) (files []fileInfo, e error) {
+	w := newWalker(root, 0, true)
+	w.all = true
+	return w.run()
+}
+
+func newWalker(root string, pid uint64, noDirs bool) *walker {
+	return &walker{
+		root:    root,
+		pid:     pid,
+		filter:  newWalkFilter(root),
+		cidMap:  make(map[string]uint64),
+		visited: make(map[string]bool),
+		pending: make(map[string]bool),
+		noDirs:  noDirs,
+	}
+}
+
+// 开始遍历
+func (w *walker) run() (files []fileInfo, e error) {
+	root := w.root
+	// 要上传的文件夹本身是符号链接时遍历其指向的文件夹
+	real := root
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		real = r
+	}
+	e = w.walk(real, root)
+
+	return w.files, e
+}
+
+// 记录跳过的文件
+func skipped(path, reason string) {
+	log.Printf("跳过 %s ：%s", path, reason)
+	result.Skipped = append(result.Skipped, fmt.Sprintf("%s（%s）", path, reason))
+}
+
+// 遍历 real 文件夹，virtual 是 real 在要上传的文件夹里对应的路径，两者在跟随符号链接时不一样
+func (w *walker) walk(real, virtual string) error {
+	return filepath.WalkDir(real, func(path string, d fs.DirEntry, err error) error {
+		path = filepath.Clean(path)
+		vpath := virtual
+		if path != real {
+			rel, err := filepath.Rel(real, path)
+			if err != nil {
+				return err
+			}
+			vpath = filepath.Join(virtual, rel)
+		}
+		return w.visit(path, vpath, d, err)
+	})
+}
+
+// 处理遍历到的文件和文件夹
+func (w *walker) visit(real, path string, d fs.DirEntry, err error) error {
+	if d == nil {
+		return fmt.Errorf("获取文件夹 %s 的信息出现错误，取消上传该文件夹：%w", path, err)
+	}
+
+	switch {
+	case d.IsDir():
+		if err != nil {
+			log.Printf("获取文件夹 %s 的信息出现错误，取消上传该文件夹：%v", path, err)
+			return fs.SkipDir
+		}
+
+		// 不上传已经移动到 -done-dir 的原文件
+		if isDoneDir(real) {
+			skipped(path, "存放已上传的原文件的文件夹")
+			return fs.SkipDir
+		}
+
+		if reason, skip := w.filter.skipDir(path, d); skip {
+			if *verbose {
+				log.Printf("跳过文件夹 %s ：%s", path, reason)
+			}
+			return fs.SkipDir
+		}
+
+		// 记录遍历过的文件夹，避免跟随符号链接时重复遍历
+		if r, err := filepath.EvalSymlinks(real); err == nil {
+			w.visited[r] = true
+		}
+
+		// 不创建空文件夹时等到有文件要上传才创建文件夹
+		if *emptyDirs && !w.noDirs {
+			if _, err := w.ensureDir(path); err != nil {
+				return err
+			}
+		}
+	case d.Type()&fs.ModeSymlink != 0:
+		if !*followSymlinks {
+			skipped(path, "符号链接")
+			return nil
+		}
+
+		info, err := os.Stat(real)
+		if err != nil {
+			skipped(path, "无效的符号链接")
+			return nil
+		}
+		if info.IsDir() {
+			return w.followDir(real, path, fs.FileInfoToDirEntry(info))
+		}
+		if !info.Mode().IsRegular() {
+			skipped(path, "符号链接指向特殊文件")
+			return nil
+		}
+
+		return w.addFile(path, fs.FileInfoToDirEntry(info))
+	case !d.Type().IsRegular():
+		skipped(path, fmt.Sprintf("特殊文件 %s", d.Type()))
+	default:
+		if err != nil {
+			log.Printf("获取文件 %s 的信息出现错误，取消上传该文件：%v", path, err)
+			return nil
+		}
+
+		return w.addFile(path, d)
+	}
+
+	return nil
+}
+
+// 遍历符号链接指向的文件夹，指向的文件夹是上级文件夹或者已经遍历过时跳过，避免循环遍历
+func (w *walker) followDir(real, path string, d fs.DirEntry) error {
+	target, err := filepath.EvalSymlinks(real)
+	if err != nil {
+		skipped(path, "无效的符号链接")
+		return nil
+	}
+	if parent, err := filepath.EvalSymlinks(filepath.Dir(real)); err == nil {
+		sep := string(filepath.Separator)
+		if strings.HasPrefix(parent+sep, strings.TrimSuffix(target, sep)+sep) {
+			skipped(path, "符号链接指向上级文件夹，存在循环")
+			return nil
+		}
+	}
+	if w.visited[target] {
+		skipped(path, "符号链接指向的文件夹已经遍历过")
+		return nil
+	}
+
+	return w.walk(target, path)
+}
+
+// 添加要上传的文件
+func (w *walker) addFile(path string, d fs.DirEntry) error {
+	if reason, skip := w.filter.skipFile(path, d); skip {
+		if *verbose {
+			log.Printf("跳过文件 %s ：%s", path, reason)
+		}
+		return nil
+	}
+
+	name, err := w.rootName()
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return err
+	}
+	rel = filepath.Join(name, rel)
+	if *incremental && !w.all {
+		info, err := d.Info()
+		if err == nil && skipUnchanged(path, rel, info) {
+			return nil
+		}
+	}
+
+	if w.noDirs {
+		w.files = append(w.files, fileInfo{Path: path, Rel: rel})
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	pid, err := w.ensureDir(dir)
+	if err != nil {
+		return err
+	}
+	w.files = append(w.files, fileInfo{
+		Path:       path,
+		ParentID:   pid,
+		RemoteDir:  filepath.ToSlash(filepath.Dir(rel)),
+		Rel:        rel,
+		dirPending: w.pending[dir],
+	})
+
+	return nil
+}
+
+// 要上传的文件夹在 115 网盘里的名字
+func (w *walker) rootName() (string, error) {
+	if w.root == "." {
+		abs, err := filepath.Abs(w.root)
+		if err != nil {
+			return "", fmt.Errorf("获取文件夹 %s 的绝对路径失败，取消上传该文件夹：%w", w.root, err)
+		}
+		return filepath.Base(abs), nil
+	}
+	return filepath.Base(w.root), nil
+}
+
+// 在 115 网盘创建文件夹及其还没创建的上级文件夹，返回文件夹的 cid
+func (w *walker) ensureDir(path string) (cid uint64, e error) {
+	if cid, ok := w.cidMap[path]; ok {
+		return cid, nil
+	}
+
+	var pid uint64
+	var filename string
+	pdir := filepath.Dir(path)
+	if path == w.root {
+		pid = w.pid
+		var err error
+		if filename, err = w.rootName(); err != nil {
+			return 0, err
+		}
+	} else {
+		if pdir == path {
+			return 0, fmt.Errorf("%s 不在文件夹 %s 里", path, w.root)
+		}
+		var err error
+		pid, err = w.ensureDir(pdir)
+		if err != nil {
+			return 0, err
+		}
+		filename = filepath.Base(path)
+	}
+
+	if *dryRun {
+		// 演习时不创建文件夹，只从文件夹缓存里查找已经创建的文件夹
+		cid, ok := dirCache.get(pid, filename)
+		if !ok || (path != w.root && w.pending[pdir]) {
+			cid = 0
+			w.pending[path] = true
+		}
+		w.cidMap[path] = cid
+		return cid, nil
+	}
+
+	cid, err := cachedCreateDir(pid, filename)
+	if errors.Is(err, errDirNotFound) && path != w.root {
+		// 缓存的上级文件夹已经不存在，重新创建上级文件夹
+		delete(w.cidMap, pdir)
+		if pid, err = w.ensureDir(pdir); err != nil {
+			return 0, err
+		}
+		cid, err = cachedCreateDir(pid, filename)
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.cidMap[path] = cid
+
+	return cid, nil
+}
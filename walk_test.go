@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 设置遍历文件夹用到的参数
+func setWalkFlags(follow, empty bool) {
+	verbose = new(bool)
+	doneDir = new(string)
+	incremental = new(bool)
+	dryRun = new(bool)
+	*dryRun = true
+	followSymlinks = &follow
+	emptyDirs = &empty
+}
+
+// 新建测试用的文件夹，links 是符号链接和其指向的路径
+func walkTree(t *testing.T, files []string, links map[string]string) string {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "r")
+	for _, name := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range links {
+		if err := os.Symlink(filepath.FromSlash(target), filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Skipf("不支持符号链接：%v", err)
+		}
+	}
+	return root
+}
+
+// 遍历到的文件相对上传的文件夹的上级文件夹的路径
+func walkRels(t *testing.T, root string) []string {
+	t.Helper()
+	files, err := walkLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rels := make([]string, 0, len(files))
+	for _, file := range files {
+		rels = append(rels, filepath.ToSlash(file.Rel))
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+// 是否记录了跳过的文件
+func hasSkipped(path, reason string) bool {
+	for _, s := range result.Skipped {
+		if strings.HasPrefix(s, path+"（") && strings.Contains(s, reason) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWalkSymlinkLoops(t *testing.T) {
+	defer func(r resultData) { result = r }(result)
+	tests := []struct {
+		name    string
+		files   []string
+		links   map[string]string
+		want    []string
+		skipped string
+	}{
+		{
+			"sibling",
+			[]string{"x/fx", "y/fy"},
+			map[string]string{"x/l": "../y", "y/l": "../x"},
+			[]string{"r/x/fx", "r/x/l/fy", "r/y/fy"},
+			"y/l",
+		},
+		{
+			"ancestor",
+			[]string{"a/b/f"},
+			map[string]string{"a/b/up": "..", "a/root": "../"},
+			[]string{"r/a/b/f"},
+			"a/b/up",
+		},
+		{
+			"self",
+			[]string{"f"},
+			map[string]string{"self": "."},
+			[]string{"r/f"},
+			"self",
+		},
+	}
+	for _, tt := range tests {
+		setWalkFlags(true, false)
+		result = resultData{}
+		root := walkTree(t, tt.files, tt.links)
+		if rels := walkRels(t, root); !reflect.DeepEqual(rels, tt.want) {
+			t.Errorf("%s: walked files want: %v, result: %v", tt.name, tt.want, rels)
+		}
+		if !hasSkipped(filepath.Join(root, filepath.FromSlash(tt.skipped)), "循环") &&
+			!hasSkipped(filepath.Join(root, filepath.FromSlash(tt.skipped)), "已经遍历过") {
+			t.Errorf("%s: %s should be skipped, skipped: %v", tt.name, tt.skipped, result.Skipped)
+		}
+	}
+}
+
+func TestWalkSymlinks(t *testing.T) {
+	defer func(r resultData) { result = r }(result)
+	files := []string{"a.txt", "dir/b.txt"}
+	links := map[string]string{"dangling": "missing", "file": "a.txt", "linked": "dir", "outside": "../o"}
+
+	// 不跟随符号链接时跳过所有符号链接
+	setWalkFlags(false, false)
+	result = resultData{}
+	root := walkTree(t, files, links)
+	if err := os.MkdirAll(filepath.Join(root, "..", "o"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "..", "o", "c.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rels, want := walkRels(t, root), []string{"r/a.txt", "r/dir/b.txt"}; !reflect.DeepEqual(rels, want) {
+		t.Errorf("walked files without following symlinks want: %v, result: %v", want, rels)
+	}
+	for link := range links {
+		if !hasSkipped(filepath.Join(root, link), "符号链接") {
+			t.Errorf("%s should be skipped, skipped: %v", link, result.Skipped)
+		}
+	}
+
+	// 跟随符号链接时跳过无效的符号链接和指向已经遍历过的文件夹的符号链接
+	setWalkFlags(true, false)
+	result = resultData{}
+	want := []string{"r/a.txt", "r/dir/b.txt", "r/file", "r/outside/c.txt"}
+	if rels := walkRels(t, root); !reflect.DeepEqual(rels, want) {
+		t.Errorf("walked files following symlinks want: %v, result: %v", want, rels)
+	}
+	if !hasSkipped(filepath.Join(root, "dangling"), "无效的符号链接") ||
+		!hasSkipped(filepath.Join(root, "linked"), "已经遍历过") || len(result.Skipped) != 2 {
+		t.Errorf("dangling symlink and walked dir should be skipped, skipped: %v", result.Skipped)
+	}
+}
+
+func TestWalkEmptyDirs(t *testing.T) {
+	defer func(r resultData, dc *dirCacheData) { result, dirCache = r, dc }(result, dirCache)
+	dirCache = nil
+	root := walkTree(t, []string{"a.txt", "empty/", "sub/nested/"}, nil)
+
+	for _, empty := range []bool{false, true} {
+		setWalkFlags(false, empty)
+		w := newWalker(root, 0, false)
+		files, err := w.run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 || !files[0].dirPending {
+			t.Errorf("walked files want: [a.txt] in pending dir, result: %+v", files)
+		}
+		// 演习时还没创建的文件夹记录为 pending
+		for _, dir := range []string{"empty", "sub", filepath.Join("sub", "nested")} {
+			if _, ok := w.cidMap[filepath.Join(root, dir)]; ok != empty || w.pending[filepath.Join(root, dir)] != empty {
+				t.Errorf("-empty-dirs=%v: dir %s created: %v", empty, dir, ok)
+			}
+		}
+	}
+}
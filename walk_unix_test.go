@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestWalkSpecialFiles(t *testing.T) {
+	defer func(r resultData) { result = r }(result)
+	setWalkFlags(true, false)
+	result = resultData{}
+	root := walkTree(t, []string{"a.txt"}, map[string]string{"pipe-link": "pipe"})
+	if err := syscall.Mkfifo(filepath.Join(root, "pipe"), 0644); err != nil {
+		t.Skipf("不支持命名管道：%v", err)
+	}
+
+	if rels, want := walkRels(t, root), []string{"r/a.txt"}; !reflect.DeepEqual(rels, want) {
+		t.Errorf("walked files want: %v, result: %v", want, rels)
+	}
+	if !hasSkipped(filepath.Join(root, "pipe"), "特殊文件") {
+		t.Errorf("named pipe should be skipped, skipped: %v", result.Skipped)
+	}
+	if !hasSkipped(filepath.Join(root, "pipe-link"), "符号链接指向特殊文件") {
+		t.Errorf("symlink to named pipe should be skipped, skipped: %v", result.Skipped)
+	}
+}